@@ -10,9 +10,15 @@ import (
 	"time"
 
 	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/aggregate"
 	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/agreceiver"
 	"github.com/impr0ver/metrics-service/internal/agwork"
+	"github.com/impr0ver/metrics-service/internal/collector"
 	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/relabel"
+	"github.com/impr0ver/metrics-service/internal/spool"
+	"go.uber.org/zap"
 )
 
 var (
@@ -30,60 +36,83 @@ func main() {
 	var sLogger = logger.NewLogger()
 
 	cfg := agconfig.InitConfig()
-	cfg.RealHostIP = agwork.GetHostIP(cfg.Address)
-	
-	if cfg.GRPCAddress != "" {
-		sender = agwork.GRPCSendMetrics{Cfg: cfg, Am: &agMemory, Mu: &mu}
+
+	windows, err := aggregate.New(cfg.Aggregations)
+	if err != nil {
+		sLogger.Fatalf("aggregations config error: %v", err)
+	}
+	agMemory.Windows = windows
+
+	rules, err := relabel.New(cfg.Relabel)
+	if err != nil {
+		sLogger.Fatalf("relabel config error: %v", err)
+	}
+
+	if len(cfg.Outputs) == 0 {
+		s, closeSender, err := newSender(cfg, &agMemory, &mu, rules, sLogger)
+		if err != nil {
+			sLogger.Fatalf("sender error: %v", err)
+		}
+		defer closeSender()
+		sender = s
 	} else {
-		sender = agwork.HTTPSendMetrics{Cfg: cfg, Am: &agMemory, Mu: &mu}
+		//one sender with its own memory, retries and spool for every output
+		fanOut := agwork.FanOut{Am: &agMemory, Mu: &mu}
+		for _, o := range cfg.Outputs {
+			outAm := agmemory.NewAgMemory()
+			outMu := &sync.RWMutex{}
+			s, closeSender, err := newSender(cfg.WithOutput(o), &outAm, outMu, rules, sLogger)
+			if err != nil {
+				sLogger.Fatalf("output %s error: %v", o.Name, err)
+			}
+			defer closeSender()
+			fanOut.Outputs = append(fanOut.Outputs, agwork.Output{Name: o.Name, Sender: s, Am: &outAm, Mu: outMu})
+			sLogger.Infof("Output %s sends metrics to %s server %s", o.Name, o.Type, o.Address)
+		}
+		sender = fanOut
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
-	pollIntTicker := time.NewTicker(cfg.PollInterval)
-	defer pollIntTicker.Stop()
-	pollIntGopsTicker := time.NewTicker(cfg.PollInterval)
-	defer pollIntGopsTicker.Stop()
+	collectors, err := collector.New(cfg)
+	if err != nil {
+		sLogger.Fatalf("collectors config error: %v", err)
+	}
+
 	repIntTicker := time.NewTicker(cfg.ReportInterval)
 	defer repIntTicker.Stop()
 
-	//one routine for set runtime metrics
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case <-ctx.Done():
-				stop()
-				sLogger.Infoln("- Set \"runtime\" metrics is shutdown...")
-				return
-			case t := <-pollIntTicker.C:
-				sLogger.Infoln("Set \"runtime\" metrics at", t.Format("04:05"))
-				agwork.SetRTMetrics(&agMemory, &mu)
-			}
-		}
-	}()
+	//one routine for every collector
+	for _, c := range collectors {
+		wg.Add(1)
+		go func(c collector.Collector) {
+			defer wg.Done()
+			collector.Run(ctx, c, &agMemory, &mu)
+		}(c)
+	}
 
-	//one routine for set gops metrics
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case <-ctx.Done():
-				stop()
-				sLogger.Infoln("- Set \"gops\" metrics is shutdown...")
-				return
-			case t := <-pollIntGopsTicker.C:
-				sLogger.Infoln("Set \"gops\" metrics at", t.Format("04:05"))
-				err := agwork.SetGopsMetrics(&agMemory, &mu)
-				if err != nil {
-					sLogger.Errorf("error in set gops metrics, %v", err)
-				}
+	//optional receivers of metrics pushed by local applications
+	if cfg.PushAddress != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sLogger.Info("Push receiver is listening on ", cfg.PushAddress)
+			if err := agreceiver.ListenAndServe(ctx, cfg.PushAddress, &agMemory, &mu); err != nil {
+				sLogger.Fatalf("push receiver error: %v", err)
 			}
-		}
-	}()
+		}()
+	}
+	if cfg.StatsdSocket != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sLogger.Info("StatsD is listening on unixgram ", cfg.StatsdSocket)
+			if err := agreceiver.ListenStatsD(ctx, cfg.StatsdSocket, cfg.PollInterval, &agMemory, &mu); err != nil {
+				sLogger.Fatalf("statsd receiver error: %v", err)
+			}
+		}()
+	}
 
 	//one routine for send metrics
 	wg.Add(1)
@@ -109,13 +138,41 @@ func main() {
 	ctx, cancelFunc := context.WithTimeout(context.Background(), cfg.ReportInterval)
 	defer cancelFunc()
 
-	err := lastSendMetrics(ctx, sender, cfg)
+	err = lastSendMetrics(ctx, sender, cfg)
 	if err != nil {
 		sLogger.Info("lastSendMetrics task exited with error", err)
 	}
 
 }
 
+// newSender returns the sender of metrics of the memory by cfg with its own spool and retry state,
+// closeSender closes its connection.
+func newSender(cfg agconfig.Config, am *agmemory.AgMemory, mu *sync.RWMutex, rules *relabel.Rules, sLogger *zap.SugaredLogger) (agwork.Sender, func(), error) {
+	var sp *spool.Spool
+	if cfg.SpoolDir != "" {
+		var err error
+		sp, err = spool.Open(cfg.SpoolDir, cfg.SpoolMaxSize, cfg.SpoolMaxAge)
+		if err != nil {
+			return nil, nil, fmt.Errorf("spool error: %w", err)
+		}
+		sLogger.Infof("Spool %s has %d batches to send", cfg.SpoolDir, sp.Len())
+	}
+
+	retrier := agwork.NewRetrier(cfg)
+	if cfg.GRPCAddress != "" {
+		creds, err := agwork.TransportCredentials(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gRPC TLS config error: %w", err)
+		}
+		stream := agwork.NewStreamClient(cfg.GRPCAddress, creds)
+		closeSender := func() { stream.Close() }
+		return agwork.GRPCSendMetrics{Cfg: cfg, Am: am, Mu: mu, Stream: stream, Spool: sp, Retry: retrier, Relabel: rules}, closeSender, nil
+	}
+
+	cfg.RealHostIP = agwork.GetHostIP(cfg.Address)
+	return agwork.HTTPSendMetrics{Cfg: cfg, Am: am, Mu: mu, Spool: sp, Retry: retrier, Relabel: rules}, func() {}, nil
+}
+
 func lastSendMetrics(ctx context.Context, sender agwork.Sender, cfg agconfig.Config) error {
 	for {
 		select {
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/impr0ver/metrics-service/internal/crypt"
+)
+
+func main() {
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "Comma-separated server DNS names and IP addresses")
+	flag.Parse()
+
+	err := crypt.GenCerts("./", strings.Split(*hosts, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -10,14 +10,23 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/impr0ver/metrics-service/internal/crypt"
+	"github.com/impr0ver/metrics-service/internal/graphite"
 	"github.com/impr0ver/metrics-service/internal/handlers"
+	"github.com/impr0ver/metrics-service/internal/health"
 	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/otlp"
 	"github.com/impr0ver/metrics-service/internal/servconfig"
+	"github.com/impr0ver/metrics-service/internal/statsd"
+	"github.com/impr0ver/metrics-service/internal/statsd/statsdstore"
 	"github.com/impr0ver/metrics-service/internal/storage"
 	"golang.org/x/sync/errgroup"
 
 	proto "github.com/impr0ver/metrics-service/internal/rpc"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -56,11 +65,53 @@ func main() {
 		return httpServer.ListenAndServe()
 	})
 
-	g.Go(func() error {
-		sLogger.Info("gRPC is listening...")
-		rpcSrv = StartGRPCServer(cfg, memStor)
-		return nil
-	})
+	if cfg.GRPCAddr != "" {
+		var err error
+		rpcSrv, err = NewGRPCServer(cfg, memStor)
+		if err != nil {
+			sLogger.Fatalf("gRPC server error: %v", err)
+		}
+		listen, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			sLogger.Fatalf("can not listen gRPC address %s: %v", cfg.GRPCAddr, err)
+		}
+		g.Go(func() error {
+			sLogger.Info("gRPC is listening on ", cfg.GRPCAddr)
+			return rpcSrv.Serve(listen)
+		})
+	}
+
+	// optional StatsD receiver
+	if cfg.StatsdAddr != "" || cfg.StatsdSocket != "" {
+		aggregator := statsd.NewAggregator()
+		g.Go(func() error {
+			return statsdstore.Run(gCtx, aggregator, memStor, cfg.StatsdFlushInterval)
+		})
+		if cfg.StatsdAddr != "" {
+			g.Go(func() error {
+				sLogger.Info("StatsD is listening on udp ", cfg.StatsdAddr)
+				return statsd.ListenAndServe(gCtx, "udp", cfg.StatsdAddr, aggregator)
+			})
+		}
+		if cfg.StatsdSocket != "" {
+			g.Go(func() error {
+				sLogger.Info("StatsD is listening on unixgram ", cfg.StatsdSocket)
+				return statsd.ListenAndServe(gCtx, "unixgram", cfg.StatsdSocket, aggregator)
+			})
+		}
+	}
+
+	// optional Graphite receiver
+	if cfg.GraphiteAddr != "" {
+		parser, err := graphite.NewParser(cfg.GraphiteTemplates)
+		if err != nil {
+			sLogger.Fatalf("graphite templates error: %v", err)
+		}
+		g.Go(func() error {
+			sLogger.Info("Graphite is listening on tcp ", cfg.GraphiteAddr)
+			return graphite.ListenAndServe(gCtx, cfg.GraphiteAddr, parser, memStor)
+		})
+	}
 
 	g.Go(func() error {
 		<-gCtx.Done()
@@ -101,27 +152,30 @@ func buildInfo() {
 	fmt.Println("Build commit: ", buildCommit)
 }
 
-func StartGRPCServer(c servconfig.Config, ms storage.MemoryStoragerInterface) *grpc.Server {
-	var sLogger = logger.NewLogger()
-	// defining the port for the server
-	listen, err := net.Listen("tcp", "localhost:9090")
-	if err != nil {
-		sLogger.Info("Can not start listen port 9090")
-		return nil
+// NewGRPCServer creates gRPC server with interceptors and services. TLS is enabled if the certificate is set,
+// mutual TLS if the client CA is set.
+func NewGRPCServer(c servconfig.Config, ms storage.MemoryStoragerInterface) (*grpc.Server, error) {
+	idem := handlers.NewIdempotencyStore(ms) // the same keys for unary calls and stream batches
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpc.UnaryServerInterceptor(handlers.LoggingInterceptor),
+			grpc.UnaryServerInterceptor(handlers.VerifyDataInterceptor(c)),
+			grpc.UnaryServerInterceptor(handlers.DecryptDataInterceptor(c)),
+			grpc.UnaryServerInterceptor(handlers.IdempotencyInterceptor(c, idem))),
+		grpc.ChainStreamInterceptor(handlers.VerifyDataStreamInterceptor(c), handlers.DecryptDataStreamInterceptor(c)),
 	}
-
-	// creates a gRPC server which has no service registered
-	s := grpc.NewServer(grpc.ChainUnaryInterceptor(grpc.UnaryServerInterceptor(handlers.LoggingInterceptor),
-		grpc.UnaryServerInterceptor(handlers.VerifyDataInterceptor(c)),
-		grpc.UnaryServerInterceptor(handlers.DecryptDataInterceptor(c))))
+	if c.GRPCTLSCert != "" {
+		tlsCfg, err := crypt.ServerTLSConfig(c.GRPCTLSCert, c.GRPCTLSKey, c.GRPCClientCA)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	s := grpc.NewServer(opts...)
 
 	// service register
-	proto.RegisterMetricsExhangeServer(s, handlers.RPC{Config: c, Ms: ms})
+	proto.RegisterMetricsExhangeServer(s, handlers.RPC{Config: c, Ms: ms, Idem: idem})
+	colmetricspb.RegisterMetricsServiceServer(s, otlp.MetricsService{Ms: ms, Cumulative: otlp.NewCumulative()})
+	healthpb.RegisterHealthServer(s, health.NewChecker(&c, ms))
 	reflection.Register(s)
-	go func() {
-		if err := s.Serve(listen); err != nil {
-			sLogger.Fatal(err)
-		}
-	}()
-	return s
+	return s, nil
 }
\ No newline at end of file
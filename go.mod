@@ -5,6 +5,8 @@ go 1.20
 require (
 	github.com/caarlos0/env/v6 v6.10.1
 	github.com/go-chi/chi/v5 v5.0.11
+	github.com/golang/snappy v0.0.4
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.20.0
 	github.com/jackc/pgerrcode v0.0.0-20220416144525-469b46aa5efa
 	github.com/jackc/pgx v3.6.2+incompatible
 	github.com/jackc/pgx/v5 v5.5.2
@@ -12,9 +14,11 @@ require (
 	github.com/stretchr/testify v1.8.4
 	github.com/timakin/bodyclose v0.0.0-20240125160201-f835fa56326a
 	gitlab.com/bosi/decorder v0.4.2
+	go.opentelemetry.io/proto/otlp v1.3.1
 	go.uber.org/zap v1.26.0
 	golang.org/x/sync v0.7.0
 	golang.org/x/tools v0.20.0
+	google.golang.org/genproto/googleapis/api v0.0.0-20240513163218-0867130af1f8
 	google.golang.org/grpc v1.64.0
 	google.golang.org/protobuf v1.34.1
 	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0
@@ -46,7 +50,7 @@ require (
 	golang.org/x/mod v0.17.0 // indirect
 	golang.org/x/net v0.24.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	golang.org/x/text v0.15.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240513163218-0867130af1f8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
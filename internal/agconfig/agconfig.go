@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v6"
@@ -28,20 +31,108 @@ type (
 		PathToPublicKey string         `env:"CRYPTO_KEY" json:"crypto_key"`
 		PublicKey       *rsa.PublicKey `json:"-"`
 		RealHostIP      string         `json:"-"`
-		GRPCAddress     string         `json:"-"`
+		GRPCAddress     string         `env:"GRPC_ADDRESS" json:"grpc_address"`
+		GRPCCACert      string         `env:"GRPC_CA_CERT" json:"grpc_ca_cert"`
+		GRPCTLSCert     string         `env:"GRPC_TLS_CERT" json:"grpc_tls_cert"`
+		GRPCTLSKey      string         `env:"GRPC_TLS_KEY" json:"grpc_tls_key"`
+		// Collectors settings by collector name, EnabledCollectors (comma-separated names) overrides "enabled" of all collectors.
+		Collectors        map[string]CollectorConfig `json:"collectors"`
+		EnabledCollectors string                     `env:"COLLECTORS" json:"-"`
+		// PushAddress (loopback HTTP) and StatsdSocket (unixgram) receive metrics pushed by local applications, empty disables.
+		PushAddress  string `env:"PUSH_ADDRESS" json:"push_address"`
+		StatsdSocket string `env:"STATSD_SOCKET" json:"statsd_socket"`
+		// SpoolDir directory of batches which are not sent, empty disables. Zero SpoolMaxSize (bytes) or SpoolMaxAge means no limit.
+		SpoolDir     string        `env:"SPOOL_DIR" json:"spool_dir"`
+		SpoolMaxSize int64         `env:"SPOOL_MAX_SIZE" json:"spool_max_size"`
+		SpoolMaxAge  time.Duration `env:"SPOOL_MAX_AGE" json:"spool_max_age"`
+		// Retries of requests to the server with exponential backoff, the circuit breaker stops requests
+		// for BreakerCooldown after BreakerThreshold failures in a row (0 disables the breaker).
+		RetryMaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" json:"retry_max_attempts"`
+		RetryBackoff     time.Duration `env:"RETRY_BACKOFF" json:"retry_backoff"`
+		RetryMaxBackoff  time.Duration `env:"RETRY_MAX_BACKOFF" json:"retry_max_backoff"`
+		BreakerThreshold int           `env:"BREAKER_THRESHOLD" json:"breaker_threshold"`
+		BreakerCooldown  time.Duration `env:"BREAKER_COOLDOWN" json:"breaker_cooldown"`
+		// Aggregations of gauges over the report window, only in the config file.
+		Aggregations []AggregationRule `json:"aggregations"`
+		// Relabel rules applied to metrics before sending, only in the config file.
+		Relabel []RelabelRule `json:"relabel"`
+		// Outputs destinations which get the same metrics, only in the config file. Without outputs
+		// metrics are sent to Address (or GRPCAddress) only.
+		Outputs []OutputConfig `json:"outputs"`
+	}
+
+	// CollectorConfig settings of one collector. Nil Enabled means the default of the collector,
+	// zero Interval means PollInterval. Settings are specific to the collector.
+	CollectorConfig struct {
+		Enabled  *bool           `json:"enabled"`
+		Interval time.Duration   `json:"interval"`
+		Settings json.RawMessage `json:"settings"`
+	}
+
+	// AggregationRule aggregates gauges whose names (without labels) match one of Metrics glob patterns.
+	// Functions are min, max, mean, last and p95, all of them if empty.
+	AggregationRule struct {
+		Metrics   []string `json:"metrics"`
+		Functions []string `json:"functions"`
+	}
+
+	// RelabelRule one rule of relabeling, see package relabel. Action is keep, drop, rename, label or prefix,
+	// Regex matches the whole metric name.
+	RelabelRule struct {
+		Action      string            `json:"action"`
+		Regex       string            `json:"regex"`
+		Replacement string            `json:"replacement"`
+		Labels      map[string]string `json:"labels"`
+		Prefix      string            `json:"prefix"`
+	}
+
+	// OutputConfig one destination of metrics with its own key, public key and rate limit, see Config.WithOutput.
+	// Type is "http" or "grpc", Address is the address of the server of this type. Name is the name in logs and
+	// the spool subdirectory of the output, "<type><number>" if empty. Zero RateLimit means RateLimit of the agent.
+	OutputConfig struct {
+		Name            string         `json:"name"`
+		Type            string         `json:"type"`
+		Address         string         `json:"address"`
+		Key             string         `json:"key"`
+		RateLimit       int            `json:"rate_limit"`
+		PathToPublicKey string         `json:"crypto_key"`
+		PublicKey       *rsa.PublicKey `json:"-"`
+		GRPCCACert      string         `json:"grpc_ca_cert"`
+		GRPCTLSCert     string         `json:"grpc_tls_cert"`
+		GRPCTLSKey      string         `json:"grpc_tls_key"`
 	}
 )
 
+// Types of outputs.
+const (
+	OutputHTTP = "http"
+	OutputGRPC = "grpc"
+)
+
 var (
-	DefaultAddress         = "localhost:8080"
-	DefaultPollInterval    = 2 * time.Second
-	DefaultReportInterval  = 10 * time.Second
-	DefaultKey             = ""
-	DefaultRateLimit       = 2
-	DefaultPathToPublicKey = ""
-	DefaultGRPCAddress     = ""
-	DefaultPathToConfig    = ""
-	pathToConfig           = DefaultPathToConfig
+	DefaultAddress          = "localhost:8080"
+	DefaultPollInterval     = 2 * time.Second
+	DefaultReportInterval   = 10 * time.Second
+	DefaultKey              = ""
+	DefaultRateLimit        = 2
+	DefaultPathToPublicKey  = ""
+	DefaultGRPCAddress      = ""
+	DefaultGRPCCACert       = ""
+	DefaultGRPCTLSCert      = ""
+	DefaultGRPCTLSKey       = ""
+	DefaultCollectors       = ""
+	DefaultPushAddress      = ""
+	DefaultStatsdSocket     = ""
+	DefaultSpoolDir         = ""
+	DefaultSpoolMaxSize     = int64(100 << 20)
+	DefaultSpoolMaxAge      = 24 * time.Hour
+	DefaultRetryAttempts    = 4
+	DefaultRetryBackoff     = time.Second
+	DefaultRetryMaxBackoff  = 30 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+	DefaultPathToConfig     = ""
+	pathToConfig            = DefaultPathToConfig
 )
 
 func (c *Config) UnmarshalJSON(data []byte) error {
@@ -49,8 +140,12 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 
 	customConfig := &struct {
 		*configAlias
-		PollInterval   string `json:"poll_interval"`
-		ReportInterval string `json:"report_interval"`
+		PollInterval    string `json:"poll_interval"`
+		ReportInterval  string `json:"report_interval"`
+		SpoolMaxAge     string `json:"spool_max_age"`
+		RetryBackoff    string `json:"retry_backoff"`
+		RetryMaxBackoff string `json:"retry_max_backoff"`
+		BreakerCooldown string `json:"breaker_cooldown"`
 	}{
 		configAlias: (*configAlias)(c),
 	}
@@ -68,6 +163,46 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	c.PollInterval = duration
+	for _, d := range []struct {
+		value string
+		dst   *time.Duration
+	}{
+		{customConfig.SpoolMaxAge, &c.SpoolMaxAge},
+		{customConfig.RetryBackoff, &c.RetryBackoff},
+		{customConfig.RetryMaxBackoff, &c.RetryMaxBackoff},
+		{customConfig.BreakerCooldown, &c.BreakerCooldown},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CollectorConfig) UnmarshalJSON(data []byte) error {
+	type collectorConfigAlias CollectorConfig
+
+	customConfig := &struct {
+		*collectorConfigAlias
+		Interval string `json:"interval"`
+	}{
+		collectorConfigAlias: (*collectorConfigAlias)(c),
+	}
+
+	if err := json.Unmarshal(data, customConfig); err != nil {
+		return err
+	}
+	if customConfig.Interval == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(customConfig.Interval)
+	if err != nil {
+		return err
+	}
+	c.Interval = duration
 	return nil
 }
 
@@ -107,6 +242,52 @@ func InitConfig() Config {
 		if tmpcfg.PathToPublicKey != "" {
 			DefaultPathToPublicKey = tmpcfg.PathToPublicKey
 		}
+		if tmpcfg.GRPCAddress != "" {
+			DefaultGRPCAddress = tmpcfg.GRPCAddress
+		}
+		if tmpcfg.GRPCCACert != "" {
+			DefaultGRPCCACert = tmpcfg.GRPCCACert
+		}
+		if tmpcfg.GRPCTLSCert != "" {
+			DefaultGRPCTLSCert = tmpcfg.GRPCTLSCert
+		}
+		if tmpcfg.GRPCTLSKey != "" {
+			DefaultGRPCTLSKey = tmpcfg.GRPCTLSKey
+		}
+		if tmpcfg.PushAddress != "" {
+			DefaultPushAddress = tmpcfg.PushAddress
+		}
+		if tmpcfg.StatsdSocket != "" {
+			DefaultStatsdSocket = tmpcfg.StatsdSocket
+		}
+		if tmpcfg.SpoolDir != "" {
+			DefaultSpoolDir = tmpcfg.SpoolDir
+		}
+		if tmpcfg.SpoolMaxSize != 0 {
+			DefaultSpoolMaxSize = tmpcfg.SpoolMaxSize
+		}
+		if tmpcfg.SpoolMaxAge != 0 {
+			DefaultSpoolMaxAge = tmpcfg.SpoolMaxAge
+		}
+		if tmpcfg.RetryMaxAttempts != 0 {
+			DefaultRetryAttempts = tmpcfg.RetryMaxAttempts
+		}
+		if tmpcfg.RetryBackoff != 0 {
+			DefaultRetryBackoff = tmpcfg.RetryBackoff
+		}
+		if tmpcfg.RetryMaxBackoff != 0 {
+			DefaultRetryMaxBackoff = tmpcfg.RetryMaxBackoff
+		}
+		if tmpcfg.BreakerThreshold != 0 {
+			DefaultBreakerThreshold = tmpcfg.BreakerThreshold
+		}
+		if tmpcfg.BreakerCooldown != 0 {
+			DefaultBreakerCooldown = tmpcfg.BreakerCooldown
+		}
+		cfg.Collectors = tmpcfg.Collectors
+		cfg.Aggregations = tmpcfg.Aggregations
+		cfg.Relabel = tmpcfg.Relabel
+		cfg.Outputs = tmpcfg.Outputs
 	} else {
 		if err.Error() != "no config file" {
 			log.Printf("read config error, %v", err)
@@ -122,7 +303,22 @@ func InitConfig() Config {
 	flag.IntVar(&cfg.RateLimit, "l", DefaultRateLimit, "Rate limit.")
 	flag.StringVar(&cfg.PathToPublicKey, "crypto-key", DefaultPathToPublicKey, "Public key for asymmetric encoding")
 	flag.StringVar(&cfg.GRPCAddress, "rpc", DefaultGRPCAddress, "GRPC server address")
-	
+	flag.StringVar(&cfg.GRPCCACert, "grpc-ca", DefaultGRPCCACert, "CA of gRPC server certificate, enables TLS")
+	flag.StringVar(&cfg.GRPCTLSCert, "grpc-tls-cert", DefaultGRPCTLSCert, "gRPC client certificate for mutual TLS, enables TLS")
+	flag.StringVar(&cfg.GRPCTLSKey, "grpc-tls-key", DefaultGRPCTLSKey, "gRPC client private key for mutual TLS")
+	flag.StringVar(&cfg.EnabledCollectors, "collectors", DefaultCollectors, "Comma-separated names of enabled collectors, e.g. runtime,gops")
+	flag.StringVar(&cfg.PushAddress, "push", DefaultPushAddress, "Loopback address and port to receive metrics pushed by applications, empty disables")
+	flag.StringVar(&cfg.StatsdSocket, "statsd-socket", DefaultStatsdSocket, "StatsD unixgram socket path to receive metrics pushed by applications, empty disables")
+
+	flag.StringVar(&cfg.SpoolDir, "spool", DefaultSpoolDir, "Directory to keep batches which are not sent until the server is available, empty disables")
+	flag.Int64Var(&cfg.SpoolMaxSize, "spool-size", DefaultSpoolMaxSize, "Max size of the spool in bytes, 0 - no limit")
+	flag.DurationVar(&cfg.SpoolMaxAge, "spool-age", DefaultSpoolMaxAge, "Max age of batches in the spool, 0 - no limit")
+	flag.IntVar(&cfg.RetryMaxAttempts, "retry-attempts", DefaultRetryAttempts, "Max attempts of a request to the server, 1 - no retries")
+	flag.DurationVar(&cfg.RetryBackoff, "retry-backoff", DefaultRetryBackoff, "Initial wait between retries, doubled on every retry")
+	flag.DurationVar(&cfg.RetryMaxBackoff, "retry-max-backoff", DefaultRetryMaxBackoff, "Max wait between retries")
+	flag.IntVar(&cfg.BreakerThreshold, "breaker-threshold", DefaultBreakerThreshold, "Failed requests in a row which open the circuit breaker, 0 disables")
+	flag.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", DefaultBreakerCooldown, "How long the open circuit breaker rejects requests")
+
 	flag.Parse()
 
 	// third work with env's
@@ -176,9 +372,133 @@ func InitConfig() Config {
 		cfg.GRPCAddress = encGRPCAddr
 	}
 
+	if envGRPCCACert := os.Getenv("GRPC_CA_CERT"); envGRPCCACert != "" {
+		cfg.GRPCCACert = envGRPCCACert
+	}
+	if envGRPCTLSCert := os.Getenv("GRPC_TLS_CERT"); envGRPCTLSCert != "" {
+		cfg.GRPCTLSCert = envGRPCTLSCert
+	}
+	if envGRPCTLSKey := os.Getenv("GRPC_TLS_KEY"); envGRPCTLSKey != "" {
+		cfg.GRPCTLSKey = envGRPCTLSKey
+	}
+
+	if envCollectors := os.Getenv("COLLECTORS"); envCollectors != "" {
+		cfg.EnabledCollectors = envCollectors
+	}
+
+	if envPushAddr := os.Getenv("PUSH_ADDRESS"); envPushAddr != "" {
+		cfg.PushAddress = envPushAddr
+	}
+	if envStatsdSocket := os.Getenv("STATSD_SOCKET"); envStatsdSocket != "" {
+		cfg.StatsdSocket = envStatsdSocket
+	}
+
+	if envSpoolDir := os.Getenv("SPOOL_DIR"); envSpoolDir != "" {
+		cfg.SpoolDir = envSpoolDir
+	}
+	if envSpoolSize := os.Getenv("SPOOL_MAX_SIZE"); envSpoolSize != "" {
+		cfg.SpoolMaxSize, err = strconv.ParseInt(envSpoolSize, 10, 64)
+		if err != nil {
+			cfg.SpoolMaxSize = DefaultSpoolMaxSize
+		}
+	}
+	if envSpoolAge := os.Getenv("SPOOL_MAX_AGE"); envSpoolAge != "" {
+		cfg.SpoolMaxAge, err = time.ParseDuration(envSpoolAge)
+		if err != nil {
+			cfg.SpoolMaxAge = DefaultSpoolMaxAge
+		}
+	}
+
+	if envAttempts := os.Getenv("RETRY_MAX_ATTEMPTS"); envAttempts != "" {
+		cfg.RetryMaxAttempts, err = strconv.Atoi(envAttempts)
+		if err != nil {
+			cfg.RetryMaxAttempts = DefaultRetryAttempts
+		}
+	}
+	if envBackoff := os.Getenv("RETRY_BACKOFF"); envBackoff != "" {
+		cfg.RetryBackoff, err = time.ParseDuration(envBackoff)
+		if err != nil {
+			cfg.RetryBackoff = DefaultRetryBackoff
+		}
+	}
+	if envMaxBackoff := os.Getenv("RETRY_MAX_BACKOFF"); envMaxBackoff != "" {
+		cfg.RetryMaxBackoff, err = time.ParseDuration(envMaxBackoff)
+		if err != nil {
+			cfg.RetryMaxBackoff = DefaultRetryMaxBackoff
+		}
+	}
+	if envThreshold := os.Getenv("BREAKER_THRESHOLD"); envThreshold != "" {
+		cfg.BreakerThreshold, err = strconv.Atoi(envThreshold)
+		if err != nil {
+			cfg.BreakerThreshold = DefaultBreakerThreshold
+		}
+	}
+	if envCooldown := os.Getenv("BREAKER_COOLDOWN"); envCooldown != "" {
+		cfg.BreakerCooldown, err = time.ParseDuration(envCooldown)
+		if err != nil {
+			cfg.BreakerCooldown = DefaultBreakerCooldown
+		}
+	}
+
+	if err := initOutputs(&cfg); err != nil {
+		log.Fatalf("outputs config error, %v", err)
+	}
+
 	return cfg
 }
 
+// initOutputs checks outputs, sets default names and rate limits and reads public keys.
+func initOutputs(cfg *Config) error {
+	names := make(map[string]bool, len(cfg.Outputs))
+	for i := range cfg.Outputs {
+		o := &cfg.Outputs[i]
+		if o.Type != OutputHTTP && o.Type != OutputGRPC {
+			return fmt.Errorf("output #%d: unknown type %q", i+1, o.Type)
+		}
+		if o.Address == "" {
+			return fmt.Errorf("output #%d: no address", i+1)
+		}
+		if o.Name == "" {
+			o.Name = o.Type + strconv.Itoa(i+1)
+		}
+		if names[o.Name] || strings.ContainsAny(o.Name, `/\`) || o.Name == "." || o.Name == ".." {
+			return fmt.Errorf("output #%d: bad or duplicate name %q", i+1, o.Name)
+		}
+		names[o.Name] = true
+		if o.RateLimit == 0 {
+			o.RateLimit = cfg.RateLimit
+		}
+		if o.PathToPublicKey != "" {
+			pk, err := crypt.InitPublicKey(o.PathToPublicKey)
+			if err != nil {
+				return fmt.Errorf("output %s: can not init public key, %w", o.Name, err)
+			}
+			o.PublicKey = pk
+		}
+	}
+	return nil
+}
+
+// WithOutput returns the config of the agent for sending to the output: the address, key, public key,
+// rate limit and TLS settings are of the output, spool is the subdirectory of the output in SpoolDir.
+func (c Config) WithOutput(o OutputConfig) Config {
+	c.Address, c.GRPCAddress = "", ""
+	if o.Type == OutputGRPC {
+		c.GRPCAddress = o.Address
+	} else {
+		c.Address = o.Address
+	}
+	c.Key = o.Key
+	c.RateLimit = o.RateLimit
+	c.PathToPublicKey, c.PublicKey = o.PathToPublicKey, o.PublicKey
+	c.GRPCCACert, c.GRPCTLSCert, c.GRPCTLSKey = o.GRPCCACert, o.GRPCTLSCert, o.GRPCTLSKey
+	if c.SpoolDir != "" {
+		c.SpoolDir = filepath.Join(c.SpoolDir, o.Name)
+	}
+	c.Outputs = nil
+	return c
+}
+
 // readConfigFile - read config file from flag "-config" or env "CONFIG".
 func readConfigFile() (Config, error) {
 	var pathToConfig string
@@ -45,7 +45,18 @@ func TestInitConfig(t *testing.T) {
 		"address": "localhost:8080",
 		"report_interval": "1s",
 		"poll_interval": "1s",
-		"crypto_key": "../genkeys/public.pem"
+		"crypto_key": "../genkeys/public.pem",
+		"collectors": {"gops": {"enabled": false}, "runtime": {"interval": "5s"}},
+		"push_address": "127.0.0.1:8125",
+		"statsd_socket": "/tmp/agent-statsd.sock",
+		"spool_dir": "/var/spool/agent",
+		"spool_max_age": "1h",
+		"retry_max_attempts": 3,
+		"retry_backoff": "500ms",
+		"breaker_cooldown": "1m",
+		"aggregations": [{"metrics": ["CPUutilization*"], "functions": ["max", "p95"]}],
+		"relabel": [{"action": "rename", "regex": "CPUutilization(\\d+)", "replacement": "CPUutilization", "labels": {"cpu": "$1"}}],
+		"outputs": [{"type": "http", "address": "old:8080", "key": "old-key"}, {"name": "new", "type": "grpc", "address": "new:3200", "rate_limit": 4}]
 	}`)
 	if err != nil {
 		log.Fatal(err)
@@ -64,7 +75,68 @@ func TestInitConfig(t *testing.T) {
 	assert.Equal(t, time.Duration(1*time.Second), tmpCfg.ReportInterval, "test #readConfigFile2")
 	assert.Equal(t, time.Duration(1*time.Second), tmpCfg.PollInterval, "test #readConfigFile3")
 	assert.Equal(t, "../genkeys/public.pem", tmpCfg.PathToPublicKey, "test #readConfigFile4")
+	require.NotNil(t, tmpCfg.Collectors["gops"].Enabled, "test #readConfigFile5")
+	assert.False(t, *tmpCfg.Collectors["gops"].Enabled, "test #readConfigFile5")
+	assert.Equal(t, 5*time.Second, tmpCfg.Collectors["runtime"].Interval, "test #readConfigFile6")
+	assert.Equal(t, "127.0.0.1:8125", tmpCfg.PushAddress, "test #readConfigFile7")
+	assert.Equal(t, "/tmp/agent-statsd.sock", tmpCfg.StatsdSocket, "test #readConfigFile8")
+	assert.Equal(t, "/var/spool/agent", tmpCfg.SpoolDir, "test #readConfigFile9")
+	assert.Equal(t, time.Hour, tmpCfg.SpoolMaxAge, "test #readConfigFile10")
+	assert.Equal(t, 3, tmpCfg.RetryMaxAttempts, "test #readConfigFile11")
+	assert.Equal(t, 500*time.Millisecond, tmpCfg.RetryBackoff, "test #readConfigFile12")
+	assert.Equal(t, time.Minute, tmpCfg.BreakerCooldown, "test #readConfigFile13")
+	assert.Equal(t, []AggregationRule{{Metrics: []string{"CPUutilization*"}, Functions: []string{"max", "p95"}}},
+		tmpCfg.Aggregations, "test #readConfigFile14")
+	assert.Equal(t, []RelabelRule{{Action: "rename", Regex: `CPUutilization(\d+)`, Replacement: "CPUutilization", Labels: map[string]string{"cpu": "$1"}}},
+		tmpCfg.Relabel, "test #readConfigFile15")
+	assert.Equal(t, []OutputConfig{{Type: "http", Address: "old:8080", Key: "old-key"}, {Name: "new", Type: "grpc", Address: "new:3200", RateLimit: 4}},
+		tmpCfg.Outputs, "test #readConfigFile16")
 
 	os.Unsetenv("CONFIG")
 	os.Remove("./testConfig.json")
 }
+
+func TestOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []OutputConfig
+		wantErr bool
+	}{
+		{"no outputs #1", nil, false},
+		{"http and grpc #2", []OutputConfig{{Type: OutputHTTP, Address: "a:8080"}, {Type: OutputGRPC, Address: "b:3200"}}, false},
+		{"unknown type #3", []OutputConfig{{Type: "udp", Address: "a:8080"}}, true},
+		{"no address #4", []OutputConfig{{Type: OutputHTTP}}, true},
+		{"duplicate name #5", []OutputConfig{{Name: "a", Type: OutputHTTP, Address: "a:8080"}, {Name: "a", Type: OutputHTTP, Address: "b:8080"}}, true},
+		{"bad name #6", []OutputConfig{{Name: "../a", Type: OutputHTTP, Address: "a:8080"}}, true},
+		{"bad public key #7", []OutputConfig{{Type: OutputHTTP, Address: "a:8080", PathToPublicKey: "no-such-key.pem"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := initOutputs(&Config{RateLimit: 2, Outputs: tt.outputs})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	cfg := Config{Address: "localhost:8080", Key: "agent-key", RateLimit: 2, SpoolDir: "/var/spool/agent",
+		Outputs: []OutputConfig{{Type: OutputHTTP, Address: "old:8080"}, {Name: "new", Type: OutputGRPC, Address: "new:3200", Key: "new-key", RateLimit: 4}}}
+	require.NoError(t, initOutputs(&cfg))
+	assert.Equal(t, "http1", cfg.Outputs[0].Name, "test #default name")
+	assert.Equal(t, 2, cfg.Outputs[0].RateLimit, "test #default rate limit")
+
+	old := cfg.WithOutput(cfg.Outputs[0])
+	assert.Equal(t, "old:8080", old.Address, "test #http address")
+	assert.Equal(t, "", old.Key, "test #key of the output")
+	assert.Equal(t, "/var/spool/agent/http1", old.SpoolDir, "test #spool of the output")
+	assert.Nil(t, old.Outputs)
+
+	grpc := cfg.WithOutput(cfg.Outputs[1])
+	assert.Equal(t, "", grpc.Address, "test #grpc output has no http address")
+	assert.Equal(t, "new:3200", grpc.GRPCAddress, "test #grpc address")
+	assert.Equal(t, "new-key", grpc.Key)
+	assert.Equal(t, 4, grpc.RateLimit)
+	assert.Equal(t, "localhost:8080", cfg.Address, "test #agent config is not changed")
+}
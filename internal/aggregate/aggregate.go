@@ -0,0 +1,161 @@
+// Aggregate package keeps all samples of gauges between reports of the agent, so the report has
+// min, max, mean, last and p95 of the window besides the last value, and short spikes are not hidden.
+// Aggregated values are gauges with the function as suffix of the name, e.g. "CPUutilization1.max"
+// or "DiskUsed.p95{mountpoint="/"}". Gauges are aggregated by the rules of agconfig "aggregations".
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+)
+
+// Functions of aggregation.
+const (
+	Min  = "min"
+	Max  = "max"
+	Mean = "mean"
+	Last = "last"
+	P95  = "p95"
+)
+
+// allFunctions functions of the rule without functions.
+var allFunctions = []string{Min, Max, Mean, Last, P95}
+
+type (
+	// Windows samples of gauges in the current report window. It is guarded by the mutex of the agent memory.
+	Windows struct {
+		rules   []rule
+		matched map[string]int // rule index by metric name (IDs with other labels share it), -1 - no rule
+		samples map[string][]float64
+	}
+
+	rule struct {
+		patterns  []string
+		functions []string
+	}
+)
+
+// New returns windows of the rules, nil if there are no rules.
+func New(rules []agconfig.AggregationRule) (*Windows, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	w := &Windows{matched: make(map[string]int), samples: make(map[string][]float64)}
+	for i, r := range rules {
+		if len(r.Metrics) == 0 {
+			return nil, fmt.Errorf("aggregation #%d: no metrics", i+1)
+		}
+		for _, p := range r.Metrics {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("aggregation #%d: bad pattern %q", i+1, p)
+			}
+		}
+
+		functions := r.Functions
+		if len(functions) == 0 {
+			functions = allFunctions
+		}
+		for _, f := range functions {
+			switch f {
+			case Min, Max, Mean, Last, P95:
+			default:
+				return nil, fmt.Errorf("aggregation #%d: unknown function %q", i+1, f)
+			}
+		}
+		w.rules = append(w.rules, rule{patterns: r.Metrics, functions: functions})
+	}
+	return w, nil
+}
+
+// Add records the sample of the gauge if a rule matches its name.
+func (w *Windows) Add(id string, v float64) {
+	if w == nil || math.IsNaN(v) {
+		return
+	}
+	if w.match(id) >= 0 {
+		w.samples[id] = append(w.samples[id], v)
+	}
+}
+
+// Take returns aggregated gauges by ID with suffix and starts the new window.
+func (w *Windows) Take() map[string]float64 {
+	if w == nil {
+		return nil
+	}
+
+	res := make(map[string]float64)
+	for id, samples := range w.samples {
+		for _, f := range w.rules[w.match(id)].functions {
+			res[WithSuffix(id, f)] = apply(f, samples)
+		}
+	}
+	w.samples = make(map[string][]float64)
+	return res
+}
+
+// match returns index of the first rule matching the metric name (ID without labels), -1 if there is no one.
+func (w *Windows) match(id string) int {
+	name, _, _ := strings.Cut(id, "{")
+	if i, ok := w.matched[name]; ok {
+		return i
+	}
+
+	idx := -1
+	for i, r := range w.rules {
+		for _, p := range r.patterns {
+			if ok, _ := path.Match(p, name); ok {
+				idx = i
+				break
+			}
+		}
+		if idx >= 0 {
+			break
+		}
+	}
+	w.matched[name] = idx
+	return idx
+}
+
+// WithSuffix adds ".suffix" to the name of the metric ID before labels.
+func WithSuffix(id, suffix string) string {
+	if i := strings.IndexByte(id, '{'); i >= 0 {
+		return id[:i] + "." + suffix + id[i:]
+	}
+	return id + "." + suffix
+}
+
+// apply returns the function of samples, samples are not empty.
+func apply(f string, samples []float64) float64 {
+	switch f {
+	case Min:
+		m := samples[0]
+		for _, v := range samples[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	case Max:
+		m := samples[0]
+		for _, v := range samples[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	case Mean:
+		var sum float64
+		for _, v := range samples {
+			sum += v
+		}
+		return sum / float64(len(samples))
+	case P95:
+		// nearest-rank percentile
+		sorted := append([]float64(nil), samples...)
+		sort.Float64s(sorted)
+		return sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+	}
+	return samples[len(samples)-1]
+}
@@ -0,0 +1,75 @@
+package aggregate
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []agconfig.AggregationRule
+		wantErr bool
+	}{
+		{"no rules #1", nil, false},
+		{"all functions #2", []agconfig.AggregationRule{{Metrics: []string{"CPU*"}}}, false},
+		{"no metrics #3", []agconfig.AggregationRule{{Functions: []string{Max}}}, true},
+		{"unknown function #4", []agconfig.AggregationRule{{Metrics: []string{"CPU*"}, Functions: []string{"median"}}}, true},
+		{"bad pattern #5", []agconfig.AggregationRule{{Metrics: []string{"CPU["}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.rules)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWindows(t *testing.T) {
+	w, err := New([]agconfig.AggregationRule{
+		{Metrics: []string{"CPUutilization*"}},
+		{Metrics: []string{"DiskUsed", "CPU*"}, Functions: []string{Max}},
+	})
+	require.NoError(t, err)
+
+	for v := 1; v <= 20; v++ {
+		w.Add("CPUutilization1", float64(v))
+	}
+	w.Add(`DiskUsed{mountpoint="/"}`, 5)
+	w.Add(`DiskUsed{mountpoint="/"}`, 3)
+	w.Add("Alloc", 1)
+
+	assert.Equal(t, map[string]float64{
+		"CPUutilization1.min":          1,
+		"CPUutilization1.max":          20,
+		"CPUutilization1.mean":         10.5,
+		"CPUutilization1.last":         20,
+		"CPUutilization1.p95":          19,
+		`DiskUsed.max{mountpoint="/"}`: 5,
+	}, w.Take())
+	assert.Empty(t, w.Take(), "test #new window")
+
+	var nilWindows *Windows
+	nilWindows.Add("CPUutilization1", 1)
+	assert.Nil(t, nilWindows.Take(), "test #no aggregation")
+}
+
+func TestWindowsMatchedByName(t *testing.T) {
+	w, err := New([]agconfig.AggregationRule{{Metrics: []string{"ProcessRSS"}}})
+	require.NoError(t, err)
+
+	for pid := 0; pid < 100; pid++ {
+		w.Add(`ProcessRSS{pid="`+strconv.Itoa(pid)+`"}`, 1)
+		w.Add(`ProcessThreads{pid="`+strconv.Itoa(pid)+`"}`, 1)
+	}
+	w.Take()
+	assert.Len(t, w.matched, 2, "test #rules are cached by metric name")
+}
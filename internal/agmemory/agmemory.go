@@ -1,5 +1,7 @@
 package agmemory
 
+import "github.com/impr0ver/metrics-service/internal/aggregate"
+
 // Agent memory
 type (
 	Gauge   float64
@@ -8,6 +10,7 @@ type (
 	AgMemory struct {
 		RuntimeMetrics map[string]Gauge
 		PollCount      map[string]Counter
+		Windows        *aggregate.Windows // samples of gauges for aggregation, nil - no aggregation
 	}
 
 	Metrics struct {
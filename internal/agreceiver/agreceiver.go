@@ -0,0 +1,171 @@
+// Agreceiver package receives metrics pushed to the agent by local applications, the metrics are merged
+// into the agent memory and sent with the next report, signed and encrypted by the agent.
+// Metrics are pushed over HTTP in the JSON of the server API ("/update/" and "/updates/")
+// or in StatsD format to the unixgram socket.
+package agreceiver
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/collector"
+	"github.com/impr0ver/metrics-service/internal/statsd"
+)
+
+const (
+	// maxBodySize limit of the pushed request body.
+	maxBodySize = 10 << 20
+	// shutdownTimeout how long to wait for pushes in progress on shutdown.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Handler returns handler of "/update/" (JSON of agmemory.Metrics) and "/updates/" (JSON array of agmemory.Metrics).
+// Gauges replace the values in the agent memory, counters are added to them. Gzipped bodies are accepted.
+func Handler(am *agmemory.AgMemory, mu *sync.RWMutex) http.Handler {
+	r := chi.NewRouter()
+	r.Post("/update/", func(w http.ResponseWriter, r *http.Request) {
+		var metric agmemory.Metrics
+		if !decode(w, r, &metric) {
+			return
+		}
+		if store(w, am, mu, []agmemory.Metrics{metric}) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(metric)
+		}
+	})
+	r.Post("/updates/", func(w http.ResponseWriter, r *http.Request) {
+		var metrics []agmemory.Metrics
+		if !decode(w, r, &metrics) {
+			return
+		}
+		if store(w, am, mu, metrics) {
+			w.Write([]byte("Registered successfully!"))
+		}
+	})
+	return r
+}
+
+// decode reads JSON body into v, on error it writes the response and returns false.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body := io.Reader(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, maxBodySize)
+	}
+
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// store puts metrics in the agent memory, the request is rejected as a whole if any metric is bad.
+func store(w http.ResponseWriter, am *agmemory.AgMemory, mu *sync.RWMutex, metrics []agmemory.Metrics) bool {
+	m := collector.NewMetrics()
+	if err := m.AddJSON(metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	collector.Store(am, mu, m)
+	return true
+}
+
+// ListenAndServe serves Handler on address until ctx is done. The address must be a loopback one,
+// pushed metrics are not authenticated.
+func ListenAndServe(ctx context.Context, address string, am *agmemory.AgMemory, mu *sync.RWMutex) error {
+	if err := checkLoopback(address); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("push listen %s: %w", address, err)
+	}
+	srv := &http.Server{Handler: Handler(am, mu), ReadHeaderTimeout: shutdownTimeout}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// checkLoopback returns error if host of the address is not "localhost" or a loopback IP.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("push address %q is not a loopback address", address)
+}
+
+// ListenStatsD receives StatsD packets on the unixgram socket and merges them into the agent memory every interval
+// until ctx is done, see statsd.Aggregator.
+func ListenStatsD(ctx context.Context, socket string, interval time.Duration, am *agmemory.AgMemory, mu *sync.RWMutex) error {
+	a := statsd.NewAggregator()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- statsd.ListenAndServe(ctx, "unixgram", socket, a)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			FlushStatsD(a, am, mu)
+		case err := <-done:
+			FlushStatsD(a, am, mu)
+			return err
+		}
+	}
+}
+
+// FlushStatsD moves aggregated StatsD metrics into the agent memory.
+func FlushStatsD(a *statsd.Aggregator, am *agmemory.AgMemory, mu *sync.RWMutex) {
+	mu.RLock()
+	counters, gauges := a.Take(func(id string) (float64, bool) {
+		v, ok := am.RuntimeMetrics[id]
+		return float64(v), ok
+	})
+	mu.RUnlock()
+
+	m := collector.NewMetrics()
+	for id, v := range gauges {
+		m.Gauges[id] = agmemory.Gauge(v)
+	}
+	for id, v := range counters {
+		m.Counters[id] = agmemory.Counter(v)
+	}
+	collector.Store(am, mu, m)
+}
@@ -0,0 +1,125 @@
+package agreceiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/statsd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(s string) string {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(s))
+	zw.Close()
+	return b.String()
+}
+
+func TestHandler(t *testing.T) {
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	am.PollCount["Requests"] = 1
+	h := Handler(&am, &mu)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		gzip     bool
+		wantCode int
+	}{
+		{"gauge #1", "/update/", `{"id":"Temperature","type":"gauge","value":21.5}`, false, http.StatusOK},
+		{"counter #2", "/update/", `{"id":"Requests","type":"counter","delta":2}`, false, http.StatusOK},
+		{"batch gzip #3", "/updates/", `[{"id":"Requests","type":"counter","delta":3},{"id":"Queue","type":"gauge","value":7}]`, true, http.StatusOK},
+		{"no value #4", "/update/", `{"id":"Temperature","type":"gauge"}`, false, http.StatusBadRequest},
+		{"bad batch #5", "/updates/", `[{"id":"Bad","type":"counter","delta":1},{"id":"","type":"gauge","value":1}]`, false, http.StatusBadRequest},
+		{"bad json #6", "/updates/", `[{`, false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if tt.gzip {
+				body = gzipped(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code, rec.Body.String())
+		})
+	}
+
+	assert.Equal(t, agmemory.Gauge(21.5), am.RuntimeMetrics["Temperature"])
+	assert.Equal(t, agmemory.Gauge(7), am.RuntimeMetrics["Queue"])
+	assert.Equal(t, agmemory.Counter(6), am.PollCount["Requests"])
+	_, ok := am.PollCount["Bad"]
+	assert.False(t, ok, "bad batch is not stored")
+}
+
+func TestCheckLoopback(t *testing.T) {
+	for _, addr := range []string{"localhost:8125", "127.0.0.1:8125", "[::1]:8125"} {
+		assert.NoError(t, checkLoopback(addr), addr)
+	}
+	for _, addr := range []string{":8125", "0.0.0.0:8125", "10.0.0.1:8125", "localhost"} {
+		assert.Error(t, checkLoopback(addr), addr)
+	}
+}
+
+func TestFlushStatsD(t *testing.T) {
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	am.RuntimeMetrics["queue"] = 10
+	am.PollCount["requests"] = 1
+
+	a := statsd.NewAggregator()
+	require.NoError(t, a.AddPacket([]byte("requests:2|c\nqueue:+5|g\nlatency:100|ms\nlatency:300|ms")))
+	FlushStatsD(a, &am, &mu)
+
+	assert.Equal(t, agmemory.Counter(3), am.PollCount["requests"])
+	assert.Equal(t, agmemory.Gauge(15), am.RuntimeMetrics["queue"])
+	assert.Equal(t, agmemory.Counter(2), am.PollCount["latency.count"])
+	assert.Equal(t, agmemory.Gauge(200), am.RuntimeMetrics["latency.mean"])
+}
+
+func TestListenStatsD(t *testing.T) {
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	socket := filepath.Join(t.TempDir(), "statsd.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ListenStatsD(ctx, socket, time.Hour, &am, &mu)
+	}()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("unixgram", socket)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	defer conn.Close()
+
+	_, err := conn.Write([]byte("pushed:4|c"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, agmemory.Counter(4), am.PollCount["pushed"], "metrics are flushed on shutdown")
+}
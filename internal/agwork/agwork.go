@@ -3,31 +3,31 @@ package agwork
 import (
 	"bytes"
 	"context"
-	"crypto/rsa"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"net"
-	"strconv"
-	"syscall"
 
 	"fmt"
-	"math/rand"
 	"net/http"
-	"runtime"
 	"sync"
 	"time"
 
 	"github.com/impr0ver/metrics-service/internal/agconfig"
 	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/collector"
 	"github.com/impr0ver/metrics-service/internal/crypt"
 	"github.com/impr0ver/metrics-service/internal/gzip"
+	"github.com/impr0ver/metrics-service/internal/idempotency"
+	"github.com/impr0ver/metrics-service/internal/relabel"
+	"github.com/impr0ver/metrics-service/internal/retry"
 	proto "github.com/impr0ver/metrics-service/internal/rpc"
+	"github.com/impr0ver/metrics-service/internal/spool"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
-
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
 )
 
 type (
@@ -35,354 +35,521 @@ type (
 		SendMetricsJSONBatch()
 	}
 
+	// HTTPSendMetrics sends metrics to "/updates/", batches which are not sent are kept in Spool (nil disables).
+	// Requests are retried by Retry, nil Retry makes one attempt. The report is relabeled by Relabel before it is
+	// split into batches, so batches and Spool keep relabeled metrics.
 	HTTPSendMetrics struct {
-		Cfg agconfig.Config
-		Am  *agmemory.AgMemory
-		Mu  *sync.RWMutex
+		Cfg     agconfig.Config
+		Am      *agmemory.AgMemory
+		Mu      *sync.RWMutex
+		Spool   *spool.Spool
+		Retry   *retry.Retrier
+		Relabel *relabel.Rules
 	}
 
+	// GRPCSendMetrics sends metrics to the StreamUpdates stream, batches which are not sent are kept in Spool (nil disables).
+	// Batches are retried by Retry, nil Retry makes one attempt. The report is relabeled by Relabel before it is
+	// split into batches, so batches and Spool keep relabeled metrics.
 	GRPCSendMetrics struct {
-		Cfg agconfig.Config
-		Am  *agmemory.AgMemory
-		Mu  *sync.RWMutex
+		Cfg     agconfig.Config
+		Am      *agmemory.AgMemory
+		Mu      *sync.RWMutex
+		Stream  *StreamClient
+		Spool   *spool.Spool
+		Retry   *retry.Retrier
+		Relabel *relabel.Rules
+	}
+
+	// FanOut sends the same metrics of the agent memory to several outputs. The sender of every output works
+	// with its own memory, so counters which are not sent to one output are kept only for it,
+	// and every output has its own retry state and spool.
+	FanOut struct {
+		Am      *agmemory.AgMemory
+		Mu      *sync.RWMutex
+		Outputs []Output
+	}
+
+	// Output sender of one destination and the memory it sends from.
+	Output struct {
+		Name   string
+		Sender Sender
+		Am     *agmemory.AgMemory
+		Mu     *sync.RWMutex
+	}
+
+	// StreamClient keeps one gRPC connection and one StreamUpdates stream open between reports.
+	// Batches are sent one by one, every batch waits for its acknowledgement.
+	StreamClient struct {
+		sync.Mutex
+		address string
+		creds   credentials.TransportCredentials
+		conn    *grpc.ClientConn
+		stream  proto.MetricsExhange_StreamUpdatesClient
+		cancel  context.CancelFunc
+		seq     uint64
 	}
 )
 
-func SetRTMetrics(metrics *agmemory.AgMemory, mu *sync.RWMutex) {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	var rtm runtime.MemStats
-	runtime.ReadMemStats(&rtm)
+// httpClient client of requests to the server, the timeout makes a hung request retryable.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
 
-	mu.Lock()
-	defer mu.Unlock()
+// streamAckTimeout how long to wait for acknowledgement of the batch, the stream is reopened after timeout.
+const streamAckTimeout = time.Second
 
-	metrics.RuntimeMetrics["Alloc"] = agmemory.Gauge(rtm.Alloc)
-	metrics.RuntimeMetrics["BuckHashSys"] = agmemory.Gauge(rtm.BuckHashSys)
-	metrics.RuntimeMetrics["BuckHashSys"] = agmemory.Gauge(rtm.BuckHashSys)
-	metrics.RuntimeMetrics["Frees"] = agmemory.Gauge(rtm.Frees)
-	metrics.RuntimeMetrics["GCCPUFraction"] = agmemory.Gauge(rtm.GCCPUFraction)
-	metrics.RuntimeMetrics["GCSys"] = agmemory.Gauge(rtm.HeapAlloc)
-	metrics.RuntimeMetrics["HeapAlloc"] = agmemory.Gauge(rtm.HeapAlloc)
-	metrics.RuntimeMetrics["HeapIdle"] = agmemory.Gauge(rtm.HeapIdle)
-	metrics.RuntimeMetrics["HeapInuse"] = agmemory.Gauge(rtm.HeapInuse)
-	metrics.RuntimeMetrics["HeapObjects"] = agmemory.Gauge(rtm.HeapObjects)
-	metrics.RuntimeMetrics["HeapReleased"] = agmemory.Gauge(rtm.HeapReleased)
-	metrics.RuntimeMetrics["HeapSys"] = agmemory.Gauge(rtm.HeapSys)
-	metrics.RuntimeMetrics["LastGC"] = agmemory.Gauge(rtm.LastGC)
-	metrics.RuntimeMetrics["Lookups"] = agmemory.Gauge(rtm.Lookups)
-	metrics.RuntimeMetrics["MCacheInuse"] = agmemory.Gauge(rtm.MCacheInuse)
-	metrics.RuntimeMetrics["MCacheSys"] = agmemory.Gauge(rtm.MCacheSys)
-	metrics.RuntimeMetrics["MSpanInuse"] = agmemory.Gauge(rtm.MSpanInuse)
-	metrics.RuntimeMetrics["MSpanSys"] = agmemory.Gauge(rtm.MSpanSys)
-	metrics.RuntimeMetrics["Mallocs"] = agmemory.Gauge(rtm.Mallocs)
-	metrics.RuntimeMetrics["NextGC"] = agmemory.Gauge(rtm.NextGC)
-	metrics.RuntimeMetrics["NumForcedGC"] = agmemory.Gauge(rtm.NumForcedGC)
-	metrics.RuntimeMetrics["NumGC"] = agmemory.Gauge(rtm.NumGC)
-	metrics.RuntimeMetrics["OtherSys"] = agmemory.Gauge(rtm.OtherSys)
-	metrics.RuntimeMetrics["PauseTotalNs"] = agmemory.Gauge(rtm.PauseTotalNs)
-	metrics.RuntimeMetrics["StackInuse"] = agmemory.Gauge(rtm.StackInuse)
-	metrics.RuntimeMetrics["StackSys"] = agmemory.Gauge(rtm.StackSys)
-	metrics.RuntimeMetrics["Sys"] = agmemory.Gauge(rtm.Sys)
-	metrics.RuntimeMetrics["TotalAlloc"] = agmemory.Gauge(rtm.TotalAlloc)
-	metrics.RuntimeMetrics["RandomValue"] = agmemory.Gauge(r.Float64())
-
-	metrics.PollCount["PollCount"]++
+// ErrAckTimeout returned by StreamClient.Send if the batch is not acknowledged in time,
+// the server may have applied it.
+var ErrAckTimeout = errors.New("acknowledgement of the batch is timed out")
+
+// SetRTMetrics stores metrics of the runtime collector.
+func SetRTMetrics(metrics *agmemory.AgMemory, mu *sync.RWMutex) {
+	m, _ := collector.NewRuntime(collector.RuntimeName, 0).Collect(context.Background())
+	collector.Store(metrics, mu, m)
 }
 
+// SetGopsMetrics stores metrics of the gopsutil collector.
 func SetGopsMetrics(metrics *agmemory.AgMemory, mu *sync.RWMutex) error {
-	key := "CPUutilization"
-
-	percentage, err := cpu.Percent(time.Second*1, true)
+	m, err := collector.NewGops(collector.GopsName, 0).Collect(context.Background())
 	if err != nil {
 		return err
 	}
+	collector.Store(metrics, mu, m)
+	return nil
+}
 
-	mu.Lock()
-	defer mu.Unlock()
+func (hs GRPCSendMetrics) SendMetricsJSONBatch() {
+	storeSpoolStats(hs.Spool, hs.Am, hs.Mu)
+	metrics := takeMetrics(hs.Am, hs.Mu)
+	if len(metrics) == 0 {
+		return // nothing is collected yet
+	}
+	metrics, sources := hs.Relabel.Apply(metrics)
+	if len(metrics) == 0 {
+		return // all metrics are dropped by the rules
+	}
+	sendBatches(hs.Spool, hs.Am, hs.Mu, newBatches(metrics, hs.Cfg.RateLimit), sources, hs.send)
+}
+
+// send sends one batch to the stream with retries. Batches rejected by the server are not sent again.
+func (hs GRPCSendMetrics) send(b spool.Batch) error {
+	metrics := proto.MetricsArray{Metrics: make([]*proto.Metrics, 0, len(b.Metrics))}
+	for _, m := range b.Metrics {
+		pm := &proto.Metrics{Id: m.ID}
+		if m.Value != nil {
+			pm.Mtype, pm.Value = proto.Metrics_GAUGE, *m.Value
+		}
+		if m.Delta != nil {
+			pm.Mtype, pm.Delta = proto.Metrics_COUNTER, *m.Delta
+		}
+		metrics.Metrics = append(metrics.Metrics, pm)
+	}
+
+	// one idempotency key per batch, so the retries and the resend from the spool are applied only once
+	batch := proto.StreamBatch{IdempotencyKey: b.Key}
+	if hs.Cfg.PublicKey != nil {
+		cryptMetrics := proto.CryptMetrics{}
+
+		metricsBytes, _ := json.Marshal(&metrics)
+
+		var err error
+		cryptMetrics.Cryptbuff, err = crypt.EncryptPKCS1v15(hs.Cfg.PublicKey, metricsBytes)
+		if err != nil {
+			return err
+		}
+		batch.Crypt = &cryptMetrics
+	} else { // Work with plain data
+		batch.Metrics = &metrics
+	}
 
-	for i, p := range percentage {
-		keyCPUCount := key + strconv.FormatInt(int64(i+1), 10)
-		metrics.RuntimeMetrics[keyCPUCount] = agmemory.Gauge(p)
+	// Add signature if cfg.Key is set
+	if hs.Cfg.Key != "" {
+		signature, err := crypt.SignProtoWithSHA256(batch.SignedMessage(), hs.Cfg.Key)
+		if err != nil {
+			return err
+		}
+		batch.SignatureAlg, batch.Signature = crypt.SignatureAlgSHA256PB, signature
 	}
 
-	memory, err := mem.VirtualMemory()
+	err := hs.Retry.Do(context.Background(), func() error {
+		return streamError(&batch, hs.Stream.Send(&batch))
+	})
+	if retry.IsPermanent(err) {
+		fmt.Println("batch is rejected:", err)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	metrics.RuntimeMetrics["TotalMemory"] = agmemory.Gauge(memory.Total)
-	metrics.RuntimeMetrics["FreeMemory"] = agmemory.Gauge(memory.Free)
-
+	fmt.Println("gRPC response: Successfully updated!")
 	return nil
 }
 
-func (hs GRPCSendMetrics) SendMetricsJSONBatch() {
-	// init semaphore with RATE_LIMIT
-	sem := agconfig.NewSemaphore(hs.Cfg.RateLimit)
+// streamError classifies error of StreamClient.Send for retries. The batch which is not acknowledged in time
+// is retried only with the idempotency key, without it the resend could apply the batch twice.
+func streamError(batch *proto.StreamBatch, err error) error {
+	if errors.Is(err, ErrAckTimeout) {
+		if batch.IdempotencyKey == "" {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+	return retry.GRPCError(err)
+}
 
-	hs.Mu.RLock()
-	metricsLength := len(hs.Am.RuntimeMetrics) + 1 // + 1 counter, PollCount
-	metricsArray := make([]proto.Metrics, metricsLength)
-	i := 0
+// NewStreamClient return StreamClient for the server address, the stream is opened on the first Send.
+func NewStreamClient(address string, creds credentials.TransportCredentials) *StreamClient {
+	return &StreamClient{address: address, creds: creds}
+}
 
-	for k, v := range hs.Am.RuntimeMetrics {
-		metricsArray[i].Mtype = proto.Metrics_GAUGE
-		metricsArray[i].Value = float64(v)
-		metricsArray[i].Id = k
-		i++
+// TransportCredentials returns TLS credentials if CA or client certificate is set in the config, otherwise insecure ones.
+func TransportCredentials(cfg agconfig.Config) (credentials.TransportCredentials, error) {
+	if cfg.GRPCCACert == "" && cfg.GRPCTLSCert == "" {
+		return insecure.NewCredentials(), nil
 	}
+	tlsCfg, err := crypt.ClientTLSConfig(cfg.GRPCCACert, cfg.GRPCTLSCert, cfg.GRPCTLSKey)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsCfg), nil
+}
 
-	metricsArray[i].Id = "PollCount"
-	metricsArray[i].Mtype = proto.Metrics_COUNTER
-	metricsArray[i].Delta = (int64)(hs.Am.PollCount["PollCount"])
-	hs.Mu.RUnlock()
-
-	gRPCWorker := func(sem *agconfig.Semaphore, start int, step int) {
-		sem.Acquire()       //block routine via struct{}{} literal
-		defer sem.Release() //unblock via read from chan
+// Send sends the batch and waits for its acknowledgement. The stream is reopened on the next Send after any error.
+func (sc *StreamClient) Send(batch *proto.StreamBatch) error {
+	sc.Lock()
+	defer sc.Unlock()
 
-		end := start + step
-		if end > metricsLength {
-			end = metricsLength
+	if sc.stream == nil {
+		if err := sc.open(); err != nil {
+			return err
 		}
+	}
 
-		metrics := proto.MetricsArray{}
-		metrics.Metrics = make([]*proto.Metrics, 0, end-start)
-		for i := start; i < end; i++ {
-			metrics.Metrics = append(metrics.Metrics, &metricsArray[i])
-		}
+	sc.seq++
+	batch.Seq = sc.seq
+	if err := sc.stream.Send(batch); err != nil {
+		sc.reset()
+		return err
+	}
 
-		// grpc.Dial is DEPRECATED, need to use grpc.NewClient!
-		conn, err := grpc.NewClient("passthrough:///"+hs.Cfg.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			fmt.Println(err)
-			return
+	timer := time.AfterFunc(streamAckTimeout, sc.cancel) // cancel unblocks Recv
+	ack, err := sc.stream.Recv()
+	timedOut := !timer.Stop()
+	if err != nil {
+		sc.reset()
+		if timedOut {
+			return fmt.Errorf("%w: %v", ErrAckTimeout, err)
 		}
-		defer conn.Close()
-
-		cli := proto.NewMetricsExhangeClient(conn)
+		return err
+	}
+	if ack.Seq != batch.Seq {
+		sc.reset()
+		return fmt.Errorf("got acknowledgement of batch %d, expected %d", ack.Seq, batch.Seq)
+	}
+	if ack.Error != "" {
+		return retry.Permanent(errors.New(ack.Error))
+	}
+	return nil
+}
 
-		parent := context.Background()
+// Close closes the stream and the connection.
+func (sc *StreamClient) Close() error {
+	sc.Lock()
+	defer sc.Unlock()
 
-		if hs.Cfg.PublicKey != nil {
-			cryptMetrics := proto.CryptMetrics{}
+	if sc.stream != nil {
+		sc.stream.CloseSend()
+	}
+	sc.reset()
+	if sc.conn == nil {
+		return nil
+	}
+	err := sc.conn.Close()
+	sc.conn = nil
+	return err
+}
 
-			metricsBytes, _ := json.Marshal(&metrics)
+func (sc *StreamClient) open() error {
+	if sc.conn == nil {
+		// grpc.Dial is DEPRECATED, need to use grpc.NewClient!
+		conn, err := grpc.NewClient("passthrough:///"+sc.address, grpc.WithTransportCredentials(sc.creds))
+		if err != nil {
+			return err
+		}
+		sc.conn = conn
+	}
 
-			cryptMetrics.Cryptbuff, err = crypt.EncryptPKCS1v15(hs.Cfg.PublicKey, metricsBytes)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := proto.NewMetricsExhangeClient(sc.conn).StreamUpdates(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	sc.stream, sc.cancel = stream, cancel
+	return nil
+}
 
-			// Add in metadata hash if cfg.Key is set
-			hash, err := crypt.SignDataWithSHA256([]byte(cryptMetrics.String()), hs.Cfg.Key)
-			if err == nil {
-				md := metadata.New(map[string]string{"hashsha256": hash})
-				parent = metadata.NewOutgoingContext(context.Background(), md)
-			}
+// reset drops the stream, the connection is kept.
+func (sc *StreamClient) reset() {
+	if sc.cancel != nil {
+		sc.cancel()
+	}
+	sc.stream, sc.cancel = nil, nil
+}
 
-			ctx, cancel := context.WithTimeout(parent, time.Second)
-			defer cancel()
+func (hs HTTPSendMetrics) SendMetricsJSONBatch() {
+	storeSpoolStats(hs.Spool, hs.Am, hs.Mu)
+	metrics := takeMetrics(hs.Am, hs.Mu)
+	if len(metrics) == 0 {
+		return // nothing is collected yet
+	}
+	metrics, sources := hs.Relabel.Apply(metrics)
+	if len(metrics) == 0 {
+		return // all metrics are dropped by the rules
+	}
+	sendBatches(hs.Spool, hs.Am, hs.Mu, newBatches(metrics, hs.Cfg.RateLimit), sources, hs.send)
+}
 
-			// MetricsUpdatesResponse
-			respUpdates, err := cli.CryptUpdates(ctx, &cryptMetrics)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
-			if respUpdates.Error == "" {
-				fmt.Println("gRPC response: Successfully updated!")
-			} else {
-				fmt.Println(respUpdates.Error)
-			}
-		} else { // Work with plain data
+// send sends one batch to "/updates/" with retries. Batches rejected by the server are not sent again.
+func (hs HTTPSendMetrics) send(b spool.Batch) error {
+	fullURL := fmt.Sprintf("http://%s/updates/", hs.Cfg.Address)
+	buff := new(bytes.Buffer)
 
-			// Add in metadata hash if cfg.Key is set
-			hash, err := crypt.SignDataWithSHA256([]byte(metrics.String()), hs.Cfg.Key)
-			if err == nil {
-				md := metadata.New(map[string]string{"hashsha256": hash})
-				parent = metadata.NewOutgoingContext(context.Background(), md)
-			}
+	gzip.CompressJSON(buff, b.Metrics)
 
-			ctx, cancel := context.WithTimeout(parent, time.Second)
-			defer cancel()
+	contentType := "application/json"
 
-			// MetricsUpdatesResponse
-			respUpdates, err := cli.Updates(ctx, &metrics)
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
-			if respUpdates.Error == "" {
-				fmt.Println("gRPC response: Successfully updated!")
-			} else {
-				fmt.Println(respUpdates.Error)
-			}
+	if hs.Cfg.PublicKey != nil {
+		cryptBuff, err := crypt.EncryptPKCS1v15(hs.Cfg.PublicKey, buff.Bytes())
+		if err != nil {
+			return err
 		}
+		contentType = "application/octet-stream"
+		buff.Reset()
+		buff.Write(cryptBuff)
 	}
 
-	limit := hs.Cfg.RateLimit
-	if metricsLength < limit {
-		limit = metricsLength
+	// one idempotency key per batch, so the retries and the resend from the spool are applied only once
+	err := hs.Retry.Do(context.Background(), func() error {
+		res, err := sendRequest(http.MethodPost, contentType, fullURL, buff.Bytes(), hs.Cfg.Key, hs.Cfg.RealHostIP, b.Key)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return retry.HTTPStatus(res)
+	})
+	if retry.IsPermanent(err) {
+		fmt.Println("batch is rejected:", err)
+		return nil
 	}
-	step := (metricsLength / limit) + (metricsLength % 2)
+	return err
+}
 
-	for w := 0; w < limit; w += 1 {
-		go gRPCWorker(sem, w*step, step)
+// SendMetricsJSONBatch takes metrics of the agent memory once and sends them by every output in parallel,
+// so a slow output does not delay the others. It returns when all outputs are done.
+func (f FanOut) SendMetricsJSONBatch() {
+	metrics := takeMetrics(f.Am, f.Mu)
+
+	var wg sync.WaitGroup
+	for _, o := range f.Outputs {
+		putMetrics(o.Am, o.Mu, metrics)
+		wg.Add(1)
+		go func(o Output) {
+			defer wg.Done()
+			o.Sender.SendMetricsJSONBatch()
+		}(o)
 	}
+	wg.Wait()
 }
 
-func (hs HTTPSendMetrics) SendMetricsJSONBatch() {
-	hs.Mu.RLock()
-	defer hs.Mu.RUnlock()
-
-	// init semaphore with RATE_LIMIT
-	sem := agconfig.NewSemaphore(hs.Cfg.RateLimit)
+// putMetrics puts metrics of the report in the memory of the output: gauges are replaced by gauges of the report,
+// counters are added to the counters which are not sent to the output yet.
+func putMetrics(am *agmemory.AgMemory, mu *sync.RWMutex, metrics []agmemory.Metrics) {
+	mu.Lock()
+	defer mu.Unlock()
 
-	metricData := hs.Am.RuntimeMetrics
-	pollCount := hs.Am.PollCount["PollCount"]
+	am.RuntimeMetrics = make(map[string]agmemory.Gauge, len(metrics))
+	for _, m := range metrics {
+		if m.Value != nil {
+			am.RuntimeMetrics[m.ID] = agmemory.Gauge(*m.Value)
+		}
+		if m.Delta != nil {
+			am.PollCount[m.ID] += agmemory.Counter(*m.Delta)
+		}
+	}
+}
 
-	fullURL := fmt.Sprintf("http://%s/updates/", hs.Cfg.Address)
-	var agMetrics agmemory.Metrics
+// takeMetrics returns gauges, gauges aggregated over the report window and counters of the agent memory
+// in the JSON form of the server API.
+// The server adds counters, so they are taken out of the memory: the next report has only
+// the counts since this one, counts of batches which are not sent are returned by restoreCounters.
+func takeMetrics(am *agmemory.AgMemory, mu *sync.RWMutex) []agmemory.Metrics {
+	mu.Lock()
+	defer mu.Unlock()
 
-	agMetricsArray := make([]agmemory.Metrics, 0)
+	aggregated := am.Windows.Take()
+	metrics := make([]agmemory.Metrics, 0, len(am.RuntimeMetrics)+len(aggregated)+len(am.PollCount))
 
 	// prepare gauges metrics
-	for key, value := range metricData {
-		val := new(float64)
-		*val = float64(value)
-		agMetrics.Value = val
-		agMetrics.MType = "gauge"
-		agMetrics.ID = key
-		agMetricsArray = append(agMetricsArray, agMetrics)
-	}
-
-	// prepare counter metric
-	agMetrics.ID = "PollCount"
-	agMetrics.MType = "counter"
-	agMetrics.Value = nil
-	agMetrics.Delta = (*int64)(&pollCount)
-	agMetricsArray = append(agMetricsArray, agMetrics)
-
-	// some checks
-	agMetricsLenght := len(agMetricsArray)
-	if agMetricsLenght < hs.Cfg.RateLimit {
-		hs.Cfg.RateLimit = agMetricsLenght
-	}
-	chunk := agMetricsLenght / hs.Cfg.RateLimit
-
-	w := 0
-	if hs.Cfg.RateLimit > 1 {
-		// worker pool
-		for w = 0; w < hs.Cfg.RateLimit-1; w++ {
-			go worker(sem, agMetricsArray[w*chunk:(w+1)*chunk], fullURL, hs.Cfg.Key, hs.Cfg.PublicKey, hs.Cfg.RealHostIP)
-		}
+	for key, value := range am.RuntimeMetrics {
+		val := float64(value)
+		metrics = append(metrics, agmemory.Metrics{ID: key, MType: "gauge", Value: &val})
+	}
+	for key, value := range aggregated {
+		val := value
+		metrics = append(metrics, agmemory.Metrics{ID: key, MType: "gauge", Value: &val})
 	}
-	go worker(sem, agMetricsArray[w*chunk:agMetricsLenght], fullURL, hs.Cfg.Key, hs.Cfg.PublicKey, hs.Cfg.RealHostIP)
-}
 
-func worker(sem *agconfig.Semaphore, agMetricsArray []agmemory.Metrics, fullURL string, signKey string, publicKey *rsa.PublicKey, realIP string) {
-	sem.Acquire()       //block routine via struct{}{} literal
-	defer sem.Release() //unblock via read from chan
+	// prepare counters metrics
+	for key, value := range am.PollCount {
+		delta := int64(value)
+		metrics = append(metrics, agmemory.Metrics{ID: key, MType: "counter", Delta: &delta})
+		delete(am.PollCount, key)
+	}
+	return metrics
+}
 
-	buff := new(bytes.Buffer)
+// restoreCounters adds counters of the batch which is not sent back to the agent memory.
+// Relabeled counters are returned to their source IDs, see relabel.Rules.Apply.
+func restoreCounters(am *agmemory.AgMemory, mu *sync.RWMutex, b spool.Batch, sources map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
 
-	gzip.CompressJSON(buff, agMetricsArray)
+	for _, m := range b.Metrics {
+		if m.MType == "counter" && m.Delta != nil {
+			id := m.ID
+			if src, ok := sources[id]; ok {
+				id = src
+			}
+			am.PollCount[id] += agmemory.Counter(*m.Delta)
+		}
+	}
+}
 
-	contentType := "application/json"
+// newBatches splits metrics into rateLimit batches, the last one gets the rest.
+func newBatches(metrics []agmemory.Metrics, rateLimit int) []spool.Batch {
+	if rateLimit < 1 {
+		rateLimit = 1
+	}
+	if len(metrics) < rateLimit {
+		rateLimit = len(metrics)
+	}
+	chunk := len(metrics) / rateLimit
+	now := time.Now()
+
+	batches := make([]spool.Batch, 0, rateLimit)
+	for w := 0; w < rateLimit; w++ {
+		end := (w + 1) * chunk
+		if w == rateLimit-1 {
+			end = len(metrics)
+		}
+		batches = append(batches, spool.Batch{Key: newIdempotencyKey(), Created: now, Metrics: metrics[w*chunk : end]})
+	}
+	return batches
+}
 
-	if publicKey != nil {
-		cryptBuff, err := crypt.EncryptPKCS1v15(publicKey, buff.Bytes())
-		if err != nil {
-			fmt.Println(err)
-			return
+// sendBatches sends the spooled batches first, then the new batches in parallel (one worker per batch,
+// the number of batches is limited by RATE_LIMIT). Batches which are not sent are put in the spool.
+// While the spool can not be sent, the new batches are put in the spool without sending to keep the order.
+// Without the spool counters of the batches which are not sent are returned to the agent memory.
+// It returns when all batches are sent, spooled or returned.
+func sendBatches(sp *spool.Spool, am *agmemory.AgMemory, mu *sync.RWMutex, batches []spool.Batch, sources map[string]string, send func(spool.Batch) error) {
+	spooling := false
+	if sp != nil && sp.Len() > 0 {
+		if err := sp.Replay(send); err != nil {
+			fmt.Println("spooled batches are not sent:", err)
+			spooling = true
 		}
-		contentType = "application/octet-stream"
-		buff.Reset()
-		buff.Write(cryptBuff)
 	}
 
-	res, err := sendRequest(http.MethodPost, contentType, fullURL, buff, signKey, realIP)
-	if err != nil {
-		fmt.Println(err)
+	var wg sync.WaitGroup
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b spool.Batch) {
+			defer wg.Done()
+			if !spooling {
+				err := send(b)
+				if err == nil {
+					return
+				}
+				fmt.Println(err)
+			}
+			if sp == nil {
+				restoreCounters(am, mu, b, sources)
+				return
+			}
+			if err := sp.Push(b); err != nil {
+				fmt.Println(err)
+				restoreCounters(am, mu, b, sources)
+			}
+		}(b)
+	}
+	wg.Wait()
+}
+
+// storeSpoolStats puts numbers of queued and dropped batches and the length of the spool in the agent memory.
+func storeSpoolStats(sp *spool.Spool, am *agmemory.AgMemory, mu *sync.RWMutex) {
+	if sp == nil {
 		return
 	}
-	res.Body.Close()
+	st := sp.TakeStats()
+
+	m := collector.NewMetrics()
+	m.Counters["SpoolQueuedBatches"] = agmemory.Counter(st.Queued)
+	m.Counters["SpoolDroppedBatches"] = agmemory.Counter(st.Dropped)
+	m.Gauges["SpoolBatches"] = agmemory.Gauge(st.Len)
+	collector.Store(am, mu, m)
 }
 
-func sendRequest(method, contentType, url string, body *bytes.Buffer, signKey string, realIP string) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
+// sendRequest sends one request, the body is signed if signKey is set.
+func sendRequest(method, contentType, url string, body []byte, signKey string, realIP string, idempotencyKey string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("error new request: %w", err)
+		return nil, retry.Permanent(fmt.Errorf("error new request: %w", err))
 	}
 
 	if realIP != "" {
 		req.Header.Add("X-Real-IP", realIP)
 	}
 
+	if idempotencyKey != "" {
+		req.Header.Set(idempotency.HeaderName, idempotencyKey)
+	}
+
 	req.Header.Set("Content-Type", contentType)
 	req.Header.Add("Content-Encoding", "gzip")
 
 	// check if KEY is exists and sign plainttext with SHA256 algoritm
-	hash, err := crypt.SignDataWithSHA256(body.Bytes(), signKey)
+	hash, err := crypt.SignDataWithSHA256(body, signKey)
 	if err == nil {
 		req.Header.Add("HashSHA256", hash)
 	}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
-		if errors.Is(err, syscall.ECONNREFUSED) {
-			res, err := tryToResendReq(client, req)
-			if err != nil {
-				return nil, err
-			}
-			return res, nil
-		} else {
-			return nil, fmt.Errorf("other error send data: %w", err)
-		}
+		return nil, fmt.Errorf("error send data: %w", err)
 	}
 	return res, nil
 }
 
-func tryToResendReq(client *http.Client, req *http.Request) (*http.Response, error) {
-	var err error
-	var res *http.Response
-
-	for attempts := 1; attempts < 4; attempts++ {
-		//1s 3s 5s
-		switch attempts {
-		case 1:
-			Sleep("1s")
-
-			res, err = client.Do(req)
-			if err == nil {
-				return res, nil
-			}
-
-		case 2:
-			Sleep("3s")
-
-			res, err = client.Do(req)
-			if err == nil {
-				return res, nil
-			}
-		case 3:
-			Sleep("5s")
-
-			res, err = client.Do(req)
-			if err == nil {
-				return res, nil
-			}
-		}
+// NewRetrier returns retrier of requests to the server by the config.
+func NewRetrier(cfg agconfig.Config) *retry.Retrier {
+	return &retry.Retrier{
+		Policy: retry.Policy{
+			MaxAttempts:    cfg.RetryMaxAttempts,
+			InitialBackoff: cfg.RetryBackoff,
+			MaxBackoff:     cfg.RetryMaxBackoff,
+		},
+		Breaker: retry.NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
 	}
-	return nil, fmt.Errorf("error send data after 3 attempts: %w", err)
 }
 
-func Sleep(suffix string) {
-	t, _ := time.ParseDuration(suffix)
-	fmt.Println("Try to anower resend after: ", t, ".....")
-	time.Sleep(t)
+// newIdempotencyKey returns random key for one batch of metrics.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
 }
 
 func GetHostIP(srvAddr string) string {
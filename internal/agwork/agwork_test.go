@@ -1,10 +1,35 @@
 package agwork
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/aggregate"
 	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/collector"
+	"github.com/impr0ver/metrics-service/internal/crypt"
+	"github.com/impr0ver/metrics-service/internal/handlers"
+	"github.com/impr0ver/metrics-service/internal/idempotency"
+	"github.com/impr0ver/metrics-service/internal/relabel"
+	"github.com/impr0ver/metrics-service/internal/retry"
+	proto "github.com/impr0ver/metrics-service/internal/rpc"
+	"github.com/impr0ver/metrics-service/internal/servconfig"
+	"github.com/impr0ver/metrics-service/internal/spool"
+	"github.com/impr0ver/metrics-service/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -100,3 +125,466 @@ func TestSetGopsMetrics(t *testing.T) {
 	_, ok = st.RuntimeMetrics["FreeMemory"]
 	require.True(t, ok)
 }
+
+func TestStreamClient(t *testing.T) {
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	proto.RegisterMetricsExhangeServer(srv, handlers.RPC{Config: servconfig.Config{}, Ms: ms})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	sc := NewStreamClient(lis.Addr().String(), insecure.NewCredentials())
+	for i := 0; i < 3; i++ {
+		err := sc.Send(&proto.StreamBatch{Metrics: &proto.MetricsArray{Metrics: []*proto.Metrics{
+			{Id: "PollCount", Mtype: proto.Metrics_COUNTER, Delta: 1},
+		}}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, sc.Close())
+
+	counter, err := ms.GetCounterByKey(context.Background(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, storage.Counter(3), counter)
+}
+
+// silentServer receives stream batches and never acknowledges them.
+type silentServer struct {
+	proto.UnimplementedMetricsExhangeServer
+}
+
+func (silentServer) StreamUpdates(stream proto.MetricsExhange_StreamUpdatesServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestStreamClient_ackTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	proto.RegisterMetricsExhangeServer(srv, silentServer{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	sc := NewStreamClient(lis.Addr().String(), insecure.NewCredentials())
+	defer sc.Close()
+
+	batch := &proto.StreamBatch{IdempotencyKey: "key"}
+	err = sc.Send(batch)
+	require.ErrorIs(t, err, ErrAckTimeout)
+	assert.False(t, retry.IsPermanent(streamError(batch, err)), "test #retried with idempotency key")
+
+	batch = &proto.StreamBatch{}
+	err = sc.Send(batch)
+	require.ErrorIs(t, err, ErrAckTimeout)
+	assert.True(t, retry.IsPermanent(streamError(batch, err)), "test #not retried without idempotency key")
+}
+
+func TestStreamClient_mutualTLS(t *testing.T) {
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+
+	dir := t.TempDir()
+	require.NoError(t, crypt.GenCerts(dir, []string{"127.0.0.1"}))
+	serverTLS, err := crypt.ServerTLSConfig(path.Join(dir, "server.pem"), path.Join(dir, "server-key.pem"), path.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	proto.RegisterMetricsExhangeServer(srv, handlers.RPC{Config: servconfig.Config{}, Ms: ms})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	batch := func() *proto.StreamBatch {
+		return &proto.StreamBatch{Metrics: &proto.MetricsArray{Metrics: []*proto.Metrics{
+			{Id: "Alloc", Mtype: proto.Metrics_GAUGE, Value: 1},
+		}}}
+	}
+
+	// without client certificate
+	creds, err := TransportCredentials(agconfig.Config{GRPCCACert: path.Join(dir, "ca.pem")})
+	require.NoError(t, err)
+	sc := NewStreamClient(lis.Addr().String(), creds)
+	assert.Error(t, sc.Send(batch()))
+	sc.Close()
+
+	// with client certificate
+	creds, err = TransportCredentials(agconfig.Config{
+		GRPCCACert:  path.Join(dir, "ca.pem"),
+		GRPCTLSCert: path.Join(dir, "client.pem"),
+		GRPCTLSKey:  path.Join(dir, "client-key.pem"),
+	})
+	require.NoError(t, err)
+	sc = NewStreamClient(lis.Addr().String(), creds)
+	require.NoError(t, sc.Send(batch()))
+	require.NoError(t, sc.Close())
+
+	gauge, err := ms.GetGaugeByKey(context.Background(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, storage.Gauge(1), gauge)
+}
+
+func TestSendBatches(t *testing.T) {
+	sp, err := spool.Open(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var sent []string
+	down := true
+	send := func(b spool.Batch) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			sent = append(sent, "failed")
+			return errors.New("server is down")
+		}
+		sent = append(sent, b.Key)
+		return nil
+	}
+
+	am := agmemory.AgMemory{
+		RuntimeMetrics: map[string]agmemory.Gauge{"Alloc": 1, "Sys": 2},
+		PollCount:      map[string]agmemory.Counter{"PollCount": 1},
+	}
+	metrics := takeMetrics(&am, &sync.RWMutex{})
+	batches := newBatches(metrics, 2)
+	require.Len(t, batches, 2, "test #batches by rate limit")
+	assert.Len(t, batches[1].Metrics, 2, "test #last batch gets the rest")
+
+	sendBatches(sp, &am, &sync.RWMutex{}, batches, nil, send)
+	require.Eventually(t, func() bool { return sp.Len() == 2 }, time.Second, 10*time.Millisecond, "test #failed batches are spooled")
+
+	// while the spool is not sent, the new batch is spooled without sending
+	next := spool.Batch{Key: "next", Created: time.Now()}
+	sendBatches(sp, &am, &sync.RWMutex{}, []spool.Batch{next}, nil, send)
+	require.Eventually(t, func() bool { return sp.Len() == 3 }, time.Second, 10*time.Millisecond, "test #new batch is spooled")
+	mu.Lock()
+	assert.Equal(t, []string{"failed", "failed", "failed"}, sent, "test #one replay attempt")
+	sent, down = nil, false
+	mu.Unlock()
+
+	last := spool.Batch{Key: "last", Created: time.Now()}
+	sendBatches(sp, &am, &sync.RWMutex{}, []spool.Batch{last}, nil, send)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"next", "last"}, sent[2:], "test #spool is sent first in order")
+	assert.Equal(t, 0, sp.Len(), "test #spool is empty")
+
+	am = agmemory.NewAgMemory()
+	storeSpoolStats(sp, &am, &sync.RWMutex{})
+	assert.Equal(t, agmemory.Counter(3), am.PollCount["SpoolQueuedBatches"], "test #queued stats")
+	assert.Equal(t, agmemory.Gauge(0), am.RuntimeMetrics["SpoolBatches"], "test #spool length")
+}
+
+func TestHTTPSendMetrics_spool(t *testing.T) {
+	var status atomic.Int64
+	status.Store(http.StatusServiceUnavailable)
+	var received atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status.Load() == http.StatusOK {
+			received.Add(1)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	sp, err := spool.Open(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	am := agmemory.NewAgMemory()
+	am.PollCount["PollCount"] = 1
+	hs := HTTPSendMetrics{Cfg: agconfig.Config{Address: srv.Listener.Addr().String(), RateLimit: 1}, Am: &am, Mu: &sync.RWMutex{}, Spool: sp}
+
+	hs.SendMetricsJSONBatch()
+	require.Eventually(t, func() bool { return sp.Len() == 1 }, time.Second, 10*time.Millisecond, "test #5xx batch is spooled")
+
+	status.Store(http.StatusOK)
+	hs.SendMetricsJSONBatch()
+	require.Eventually(t, func() bool { return received.Load() == 2 }, time.Second, 10*time.Millisecond, "test #spooled and new batch are sent")
+	assert.Equal(t, 0, sp.Len())
+}
+
+func TestHTTPSendMetrics_retry(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	reject := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get(idempotency.HeaderName))
+		if reject {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(keys) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := agconfig.Config{Address: srv.Listener.Addr().String(), RateLimit: 1, RetryMaxAttempts: 3, RetryBackoff: time.Millisecond}
+	hs := HTTPSendMetrics{Cfg: cfg, Retry: NewRetrier(cfg)}
+
+	require.NoError(t, hs.send(spool.Batch{Key: "batch-key"}))
+	assert.Equal(t, []string{"batch-key", "batch-key"}, keys, "test #retry with the same idempotency key")
+
+	// rejected batch is not retried and not spooled
+	mu.Lock()
+	reject = true
+	mu.Unlock()
+	require.NoError(t, hs.send(spool.Batch{Key: "bad"}))
+	assert.Len(t, keys, 3, "test #4xx is not retried")
+}
+
+func TestHTTPSendMetrics_counterDeltas(t *testing.T) {
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+	router := handlers.ChiRouter(ms, &servconfig.Config{TrustedSubnet: "127.0.0.0/8"})
+
+	var down atomic.Bool
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer requests.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	hs := HTTPSendMetrics{Cfg: agconfig.Config{Address: srv.Listener.Addr().String(), RateLimit: 2, RealHostIP: "127.0.0.1"}, Am: &am, Mu: &mu}
+
+	serverPollCount := func() storage.Counter {
+		v, _ := ms.GetCounterByKey(context.Background(), "PollCount")
+		return v
+	}
+	report := func() {
+		before := requests.Load()
+		hs.SendMetricsJSONBatch() // returns after counters of the failed batches are restored
+		require.Equal(t, before+2, requests.Load())
+	}
+
+	const polls = 10
+	for i := 1; i <= polls; i++ {
+		SetRTMetrics(&am, &mu)
+		down.Store(i > 4 && i <= 8) // reports after polls 6 and 8 fail, their counts are sent later
+		if i%2 == 0 {
+			report()
+		}
+	}
+	down.Store(false)
+	report()
+
+	assert.Equal(t, storage.Counter(polls), serverPollCount(), "test #server total equals number of polls")
+	report()
+	assert.Equal(t, storage.Counter(polls), serverPollCount(), "test #counts are sent once")
+}
+
+func TestHTTPSendMetrics_relabel(t *testing.T) {
+	var mu sync.Mutex
+	var reports [][]agmemory.Metrics // metrics of every request
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var metrics []agmemory.Metrics
+		zr, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) || !assert.NoError(t, json.NewDecoder(zr).Decode(&metrics)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		reports = append(reports, metrics)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	rules, err := relabel.New([]agconfig.RelabelRule{
+		{Action: relabel.Rename, Regex: `CPUutilization\d+`, Replacement: "CPUutilization"},
+		{Action: relabel.Rename, Regex: "(HTTP)?Requests", Replacement: "requests_total"},
+	})
+	require.NoError(t, err)
+
+	am := agmemory.NewAgMemory()
+	var amMu sync.RWMutex
+	hs := HTTPSendMetrics{Cfg: agconfig.Config{Address: srv.Listener.Addr().String(), RateLimit: 4, RealHostIP: "127.0.0.1"},
+		Am: &am, Mu: &amMu, Relabel: rules}
+
+	fill := func() {
+		am.RuntimeMetrics["CPUutilization1"] = 10
+		am.RuntimeMetrics["CPUutilization2"] = 20
+		am.RuntimeMetrics["Alloc"] = 1
+		am.RuntimeMetrics["Sys"] = 2
+		am.PollCount["Requests"] += 3
+		am.PollCount["HTTPRequests"] += 4
+		am.PollCount["PollCount"] += 1
+	}
+
+	// the failed report is returned to the source counters and relabeled again with the next one
+	fill()
+	down.Store(true)
+	hs.SendMetricsJSONBatch()
+	assert.NotContains(t, am.PollCount, "requests_total", "test #counts are returned to the source IDs")
+
+	fill()
+	down.Store(false)
+	hs.SendMetricsJSONBatch()
+
+	gauges, counters := make(map[string]int), make(map[string]int)
+	var requests int64
+	for _, metrics := range reports {
+		for _, m := range metrics {
+			if m.Value != nil {
+				gauges[m.ID]++
+			}
+			if m.Delta != nil {
+				counters[m.ID]++
+				if m.ID == "requests_total" {
+					requests = *m.Delta
+				}
+			}
+		}
+	}
+	assert.Greater(t, len(reports), 1, "test #report is split into batches")
+	assert.Equal(t, 1, gauges["CPUutilization"], "test #merged gauge is sent once")
+	assert.Equal(t, 1, counters["requests_total"], "test #merged counter is sent once")
+	assert.Equal(t, int64(14), requests, "test #merged counter sums the failed report")
+}
+
+func TestTakeMetrics_aggregation(t *testing.T) {
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	var err error
+	am.Windows, err = aggregate.New([]agconfig.AggregationRule{{Metrics: []string{"CPUutilization*"}, Functions: []string{"max"}}})
+	require.NoError(t, err)
+
+	for _, v := range []agmemory.Gauge{10, 95, 20} {
+		collector.Store(&am, &mu, collector.Metrics{Gauges: map[string]agmemory.Gauge{"CPUutilization1": v}})
+	}
+
+	gauges := make(map[string]float64)
+	for _, m := range takeMetrics(&am, &mu) {
+		gauges[m.ID] = *m.Value
+	}
+	assert.Equal(t, map[string]float64{"CPUutilization1": 20, "CPUutilization1.max": 95}, gauges, "test #spike is reported")
+}
+
+func TestFanOut(t *testing.T) {
+	type server struct {
+		ms       *storage.MemoryStorage
+		down     atomic.Bool
+		requests atomic.Int64
+	}
+	start := func() (*server, *httptest.Server) {
+		s := &server{ms: &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}}
+		router := handlers.ChiRouter(s.ms, &servconfig.Config{TrustedSubnet: "127.0.0.0/8"})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer s.requests.Add(1)
+			if s.down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			router.ServeHTTP(w, r)
+		}))
+		return s, srv
+	}
+	old, oldSrv := start()
+	defer oldSrv.Close()
+	next, nextSrv := start()
+	defer nextSrv.Close()
+
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	f := FanOut{Am: &am, Mu: &mu}
+	for _, srv := range []*httptest.Server{oldSrv, nextSrv} {
+		outAm := agmemory.NewAgMemory()
+		outMu := &sync.RWMutex{}
+		cfg := agconfig.Config{Address: srv.Listener.Addr().String(), RateLimit: 1, RealHostIP: "127.0.0.1"}
+		f.Outputs = append(f.Outputs, Output{Name: srv.URL, Sender: HTTPSendMetrics{Cfg: cfg, Am: &outAm, Mu: outMu}, Am: &outAm, Mu: outMu})
+	}
+
+	report := func() {
+		before := old.requests.Load() + next.requests.Load()
+		f.SendMetricsJSONBatch() // returns after counters of the failed batches are restored
+		require.Equal(t, before+2, old.requests.Load()+next.requests.Load())
+	}
+	pollCount := func(s *server) storage.Counter {
+		v, _ := s.ms.GetCounterByKey(context.Background(), "PollCount")
+		return v
+	}
+
+	SetRTMetrics(&am, &mu)
+	next.down.Store(true)
+	report()
+	assert.Equal(t, storage.Counter(1), pollCount(old), "test #working output is not blocked")
+	assert.Equal(t, storage.Counter(0), pollCount(next))
+
+	SetRTMetrics(&am, &mu)
+	next.down.Store(false)
+	report()
+	assert.Equal(t, storage.Counter(2), pollCount(old), "test #counts are sent once to every output")
+	assert.Equal(t, storage.Counter(2), pollCount(next), "test #unsent counts are kept for the output")
+
+	v, err := next.ms.GetGaugeByKey(context.Background(), "Alloc")
+	require.NoError(t, err)
+	assert.NotZero(t, v, "test #gauges are sent to every output")
+}
+
+func TestFanOut_hungOutput(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+	working := httptest.NewServer(handlers.ChiRouter(ms, &servconfig.Config{TrustedSubnet: "127.0.0.0/8"}))
+	defer working.Close()
+
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	f := FanOut{Am: &am, Mu: &mu}
+	for _, srv := range []*httptest.Server{hung, working} {
+		outAm := agmemory.NewAgMemory()
+		outMu := &sync.RWMutex{}
+		cfg := agconfig.Config{Address: srv.Listener.Addr().String(), RateLimit: 1, RealHostIP: "127.0.0.1"}
+		f.Outputs = append(f.Outputs, Output{Name: srv.URL, Sender: HTTPSendMetrics{Cfg: cfg, Am: &outAm, Mu: outMu}, Am: &outAm, Mu: outMu})
+	}
+
+	SetRTMetrics(&am, &mu)
+	done := make(chan struct{})
+	go func() {
+		f.SendMetricsJSONBatch()
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		v, _ := ms.GetCounterByKey(context.Background(), "PollCount")
+		return v == 1
+	}, time.Second, 5*time.Millisecond, "test #working output is not blocked by the hung one")
+
+	select {
+	case <-done:
+		t.Fatal("test #report returned before the hung output")
+	default:
+	}
+	release <- struct{}{}
+	<-done
+}
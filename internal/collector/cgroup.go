@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+)
+
+// CgroupName name of the cgroup v2 collector.
+const CgroupName = "cgroup"
+
+// Default paths of the cgroup v2 hierarchy and of the cgroup of the agent.
+const (
+	cgroupRoot     = "/sys/fs/cgroup"
+	procSelfCgroup = "/proc/self/cgroup"
+)
+
+type (
+	// Cgroup collects resources of the cgroup v2 of the agent (or of the configured cgroup directory):
+	// CgroupMemoryCurrent from memory.current, CgroupCPU* from cpu.stat ("usage_usec" is CgroupCPUUsageUsec)
+	// and CgroupIO* from io.stat with label device ("rbytes" is CgroupIORbytes). Files of disabled controllers are skipped.
+	Cgroup struct {
+		base
+		dir string
+	}
+
+	// CgroupSettings settings of the cgroup collector. Path is the cgroup directory,
+	// by default the cgroup of the agent under /sys/fs/cgroup.
+	CgroupSettings struct {
+		Path string `json:"path"`
+	}
+)
+
+func init() {
+	Register(CgroupName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s CgroupSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		return NewCgroup(name, cfg.Interval, s)
+	})
+}
+
+// NewCgroup returns cgroup v2 collector.
+func NewCgroup(name string, interval time.Duration, settings CgroupSettings) (*Cgroup, error) {
+	dir := settings.Path
+	if dir == "" {
+		var err error
+		if dir, err = selfCgroupDir(procSelfCgroup, cgroupRoot); err != nil {
+			return nil, err
+		}
+	}
+	return &Cgroup{base: base{name: name, interval: interval}, dir: dir}, nil
+}
+
+func (c *Cgroup) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+	var errs []error
+
+	if v, err := readCgroupValue(filepath.Join(c.dir, "memory.current")); err != nil {
+		errs = append(errs, err)
+	} else if v != nil {
+		m.Gauges["CgroupMemoryCurrent"] = agmemory.Gauge(*v)
+	}
+
+	err := readCgroupStat(filepath.Join(c.dir, "cpu.stat"), func(fields []string) {
+		if len(fields) != 2 {
+			return
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			m.Gauges["CgroupCPU"+camelCase(fields[0])] = agmemory.Gauge(v)
+		}
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// io.stat lines: "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0"
+	err = readCgroupStat(filepath.Join(c.dir, "io.stat"), func(fields []string) {
+		labels := map[string]string{"device": fields[0]}
+		for _, kv := range fields[1:] {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				continue
+			}
+			if value, err := strconv.ParseFloat(v, 64); err == nil {
+				m.Gauges[metricid.Format("CgroupIO"+camelCase(k), labels)] = agmemory.Gauge(value)
+			}
+		}
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return m, errors.Join(errs...)
+}
+
+// selfCgroupDir returns directory of the cgroup v2 of the process from the "0::/path" line of /proc/self/cgroup.
+func selfCgroupDir(procCgroup, root string) (string, error) {
+	data, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(root, p), nil
+		}
+	}
+	return "", fmt.Errorf("cgroup v2 is not found in %s", procCgroup)
+}
+
+// readCgroupValue reads file with one number, nil value is returned if the file does not exist.
+func readCgroupValue(p string) (*float64, error) {
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad value in %s: %w", p, err)
+	}
+	return &v, nil
+}
+
+// readCgroupStat calls fn with fields of every line of the file, missing file is skipped.
+func readCgroupStat(p string, fn func(fields []string)) error {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+	return scanner.Err()
+}
+
+// camelCase converts "usage_usec" to "UsageUsec".
+func camelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,197 @@
+// Collector package contains sources of the agent metrics. Every source implements Collector
+// and registers its factory by name, the agent runs every enabled collector with its own interval.
+// Collectors are enabled and configured in agconfig: "collectors" of the config file
+// and the list of enabled collectors (flag "-collectors", env "COLLECTORS").
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/logger"
+)
+
+type (
+	// Metrics collected by one Collect call: gauges replace the stored values, counters are added to them.
+	Metrics struct {
+		Gauges   map[string]agmemory.Gauge
+		Counters map[string]agmemory.Counter
+	}
+
+	// Collector is a source of metrics.
+	Collector interface {
+		Name() string
+		Interval() time.Duration
+		// Collect returns metrics, metrics collected before the error are returned with it.
+		Collect(ctx context.Context) (Metrics, error)
+	}
+
+	// Factory creates collector with its config, Interval of the config is always set.
+	Factory func(name string, cfg agconfig.CollectorConfig) (Collector, error)
+
+	registration struct {
+		factory Factory
+		enabled bool
+	}
+
+	// base implements Name and Interval of collectors.
+	base struct {
+		name     string
+		interval time.Duration
+	}
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]registration)
+)
+
+// Register adds collector factory by name, enabled is used if the config does not enable or disable the collector.
+func Register(name string, enabled bool, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("collector: Register called twice for " + name)
+	}
+	registry[name] = registration{factory: factory, enabled: enabled}
+}
+
+// Names returns sorted names of registered collectors.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns enabled collectors of the config sorted by name.
+func New(cfg agconfig.Config) ([]Collector, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for name := range cfg.Collectors {
+		if _, ok := registry[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q in config", name)
+		}
+	}
+
+	var enabledList map[string]bool
+	if cfg.EnabledCollectors != "" {
+		enabledList = make(map[string]bool)
+		for _, name := range strings.Split(cfg.EnabledCollectors, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := registry[name]; !ok {
+				return nil, fmt.Errorf("unknown collector %q", name)
+			}
+			enabledList[name] = true
+		}
+	}
+
+	collectors := make([]Collector, 0, len(registry))
+	for name, reg := range registry {
+		cc := cfg.Collectors[name]
+
+		enabled := reg.enabled
+		if cc.Enabled != nil {
+			enabled = *cc.Enabled
+		}
+		if enabledList != nil {
+			enabled = enabledList[name]
+		}
+		if !enabled {
+			continue
+		}
+
+		if cc.Interval <= 0 {
+			cc.Interval = cfg.PollInterval
+		}
+		c, err := reg.factory(name, cc)
+		if err != nil {
+			return nil, fmt.Errorf("collector %q: %w", name, err)
+		}
+		collectors = append(collectors, c)
+	}
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Name() < collectors[j].Name() })
+	return collectors, nil
+}
+
+// Run collects metrics every interval of the collector and stores them until ctx is done.
+func Run(ctx context.Context, c Collector, am *agmemory.AgMemory, mu *sync.RWMutex) {
+	sLogger := logger.NewLogger()
+
+	ticker := time.NewTicker(c.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			sLogger.Infof("- Collect %q metrics is shutdown...", c.Name())
+			return
+		case t := <-ticker.C:
+			sLogger.Infof("Collect %q metrics at %s", c.Name(), t.Format("04:05"))
+			m, err := c.Collect(ctx)
+			if err != nil {
+				sLogger.Errorf("error in collect %q metrics, %v", c.Name(), err)
+			}
+			Store(am, mu, m)
+		}
+	}
+}
+
+// Store puts collected metrics in the agent memory.
+func Store(am *agmemory.AgMemory, mu *sync.RWMutex, m Metrics) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for k, v := range m.Gauges {
+		am.RuntimeMetrics[k] = v
+		am.Windows.Add(k, float64(v))
+	}
+	for k, v := range m.Counters {
+		am.PollCount[k] += v
+	}
+}
+
+// AddJSON adds metrics in the JSON form of the server API, metrics before the bad one are added.
+func (m Metrics) AddJSON(metrics []agmemory.Metrics) error {
+	for _, metric := range metrics {
+		switch {
+		case metric.ID == "":
+			return errors.New("metric without id")
+		case metric.MType == "gauge" && metric.Value != nil:
+			m.Gauges[metric.ID] = agmemory.Gauge(*metric.Value)
+		case metric.MType == "counter" && metric.Delta != nil:
+			m.Counters[metric.ID] += agmemory.Counter(*metric.Delta)
+		default:
+			return fmt.Errorf("bad metric %q of type %q", metric.ID, metric.MType)
+		}
+	}
+	return nil
+}
+
+// NewMetrics returns empty Metrics.
+func NewMetrics() Metrics {
+	return Metrics{Gauges: make(map[string]agmemory.Gauge), Counters: make(map[string]agmemory.Counter)}
+}
+
+func (b base) Name() string {
+	return b.name
+}
+
+func (b base) Interval() time.Duration {
+	return b.interval
+}
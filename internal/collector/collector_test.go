@@ -0,0 +1,476 @@
+package collector_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/collector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	disabled, enabled := false, true
+
+	tests := []struct {
+		name      string
+		cfg       agconfig.Config
+		names     []string
+		intervals []time.Duration
+		wantErr   bool
+	}{
+		{
+			name:      "defaults #1",
+			cfg:       agconfig.Config{PollInterval: 2 * time.Second},
+			names:     []string{"gops", "runtime"},
+			intervals: []time.Duration{2 * time.Second, 2 * time.Second},
+		},
+		{
+			name: "interval, enable and disable in config #2",
+			cfg: agconfig.Config{PollInterval: 2 * time.Second, Collectors: map[string]agconfig.CollectorConfig{
+				"runtime": {Interval: 5 * time.Second},
+				"gops":    {Enabled: &disabled},
+				"system":  {Enabled: &enabled},
+			}},
+			names:     []string{"runtime", "system"},
+			intervals: []time.Duration{5 * time.Second, 2 * time.Second},
+		},
+		{
+			name: "list of enabled overrides config #3",
+			cfg: agconfig.Config{PollInterval: time.Second, EnabledCollectors: "gops", Collectors: map[string]agconfig.CollectorConfig{
+				"gops": {Enabled: &disabled},
+			}},
+			names:     []string{"gops"},
+			intervals: []time.Duration{time.Second},
+		},
+		{
+			name:    "unknown in list #4",
+			cfg:     agconfig.Config{EnabledCollectors: "runtime,unknown"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown in config #5",
+			cfg:     agconfig.Config{Collectors: map[string]agconfig.CollectorConfig{"unknown": {}}},
+			wantErr: true,
+		},
+		{
+			name: "filters in settings #6",
+			cfg: agconfig.Config{EnabledCollectors: "disk,net", Collectors: map[string]agconfig.CollectorConfig{
+				"disk": {Settings: json.RawMessage(`{"mounts":{"include":["/","/home*"]},"fstypes":{"exclude":["tmpfs"]}}`)},
+				"net":  {Settings: json.RawMessage(`{"interfaces":{"exclude":["lo"]}}`)},
+			}},
+			names:     []string{"disk", "net"},
+			intervals: []time.Duration{0, 0},
+		},
+		{
+			name: "unknown setting #7",
+			cfg: agconfig.Config{EnabledCollectors: "disk", Collectors: map[string]agconfig.CollectorConfig{
+				"disk": {Settings: json.RawMessage(`{"mountpoints":{"include":["/"]}}`)},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "bad pattern #8",
+			cfg: agconfig.Config{EnabledCollectors: "diskio", Collectors: map[string]agconfig.CollectorConfig{
+				"diskio": {Settings: json.RawMessage(`{"devices":{"include":["sd[a"]}}`)},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collectors, err := collector.New(tt.cfg)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			names := make([]string, 0, len(collectors))
+			intervals := make([]time.Duration, 0, len(collectors))
+			for _, c := range collectors {
+				names = append(names, c.Name())
+				intervals = append(intervals, c.Interval())
+			}
+			assert.Equal(t, tt.names, names)
+			assert.Equal(t, tt.intervals, intervals)
+		})
+	}
+}
+
+func TestRuntimeCollectAndStore(t *testing.T) {
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	c := collector.NewRuntime(collector.RuntimeName, time.Second)
+
+	for i := 0; i < 2; i++ {
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		collector.Store(&am, &mu, m)
+	}
+
+	_, ok := am.RuntimeMetrics["Alloc"]
+	assert.True(t, ok)
+	_, ok = am.RuntimeMetrics["RandomValue"]
+	assert.True(t, ok)
+	assert.Equal(t, agmemory.Counter(2), am.PollCount["PollCount"])
+}
+
+func TestRun(t *testing.T) {
+	am := agmemory.NewAgMemory()
+	var mu sync.RWMutex
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		collector.Run(ctx, collector.NewRuntime(collector.RuntimeName, 10*time.Millisecond), &am, &mu)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.RLock()
+		defer mu.RUnlock()
+		return am.PollCount["PollCount"] >= 2
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter collector.Filter
+		value  string
+		want   bool
+	}{
+		{"empty filter #1", collector.Filter{}, "sda", true},
+		{"included #2", collector.Filter{Include: []string{"sd*"}}, "sda", true},
+		{"not included #3", collector.Filter{Include: []string{"sd*"}}, "nvme0n1", false},
+		{"excluded #4", collector.Filter{Exclude: []string{"loop*"}}, "loop0", false},
+		{"exclude wins #5", collector.Filter{Include: []string{"/*"}, Exclude: []string{"/boot"}}, "/boot", false},
+		{"pattern does not cross slash #6", collector.Filter{Include: []string{"/home*"}}, "/home/user", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(tt.value))
+		})
+	}
+}
+
+func TestHostCollectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		collector collector.Collector
+		gauge     string
+	}{
+		{"system #1", collector.NewSystem(collector.SystemName, time.Second), "Uptime"},
+		{"net #2", collector.NewNet(collector.NetName, time.Second, collector.NetSettings{Interfaces: collector.Filter{Include: []string{"lo"}}}),
+			`NetBytesRecv{interface="lo"}`},
+		{"disk #3", collector.NewDisk(collector.DiskName, time.Second, collector.DiskSettings{Mounts: collector.Filter{Include: []string{"/nonexistent"}}}), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.collector.Collect(context.Background())
+			require.NoError(t, err)
+			if tt.gauge == "" {
+				assert.Empty(t, m.Gauges)
+				return
+			}
+			_, ok := m.Gauges[tt.gauge]
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+
+	tests := []struct {
+		name     string
+		settings collector.ProcessSettings
+		count    agmemory.Gauge
+		wantErr  bool
+	}{
+		{"pid file #1", collector.ProcessSettings{Processes: []collector.ProcessSelector{{Name: "self", PIDFile: pidFile}}}, 1, false},
+		{"cmdline #2", collector.ProcessSettings{Processes: []collector.ProcessSelector{{Name: "self", Cmdline: regexp.QuoteMeta(os.Args[0])}}}, 1, false},
+		{"no match #3", collector.ProcessSettings{Processes: []collector.ProcessSelector{{Name: "self", Pattern: "no-such-process-*"}}}, 0, false},
+		{"no processes #4", collector.ProcessSettings{}, 0, true},
+		{"two selections #5", collector.ProcessSettings{Processes: []collector.ProcessSelector{{Name: "self", PIDFile: pidFile, Pattern: "*"}}}, 0, true},
+		{"bad regexp #6", collector.ProcessSettings{Processes: []collector.ProcessSelector{{Name: "self", Cmdline: "("}}}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := collector.NewProcess(collector.ProcessName, time.Second, tt.settings)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			m, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.count, m.Gauges[`ProcessCount{process="self"}`])
+			if tt.count > 0 {
+				assert.Greater(t, m.Gauges[`ProcessRSS{process="self"}`], agmemory.Gauge(0))
+				assert.Greater(t, m.Gauges[`ProcessThreads{process="self"}`], agmemory.Gauge(0))
+				assert.Greater(t, m.Gauges[`ProcessOpenFDs{process="self"}`], agmemory.Gauge(0))
+			}
+		})
+	}
+}
+
+func TestCgroup(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.current"), []byte("1048576\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("usage_usec 1500\nuser_usec 1000\nsystem_usec 500\nnr_throttled 2\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "io.stat"), []byte("8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n"), 0644))
+
+	c, err := collector.NewCgroup(collector.CgroupName, time.Second, collector.CgroupSettings{Path: dir})
+	require.NoError(t, err)
+	m, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]agmemory.Gauge{
+		"CgroupMemoryCurrent":          1048576,
+		"CgroupCPUUsageUsec":           1500,
+		"CgroupCPUUserUsec":            1000,
+		"CgroupCPUSystemUsec":          500,
+		"CgroupCPUNrThrottled":         2,
+		`CgroupIORbytes{device="8:0"}`: 4096,
+		`CgroupIOWbytes{device="8:0"}`: 8192,
+		`CgroupIORios{device="8:0"}`:   1,
+		`CgroupIOWios{device="8:0"}`:   2,
+		`CgroupIODbytes{device="8:0"}`: 0,
+		`CgroupIODios{device="8:0"}`:   0,
+	}, m.Gauges)
+
+	// controllers are not enabled
+	c, err = collector.NewCgroup(collector.CgroupName, time.Second, collector.CgroupSettings{Path: t.TempDir()})
+	require.NoError(t, err)
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, m.Gauges)
+}
+
+func TestParseExecOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		gauges   map[string]agmemory.Gauge
+		counters map[string]agmemory.Counter
+		wantErr  bool
+	}{
+		{
+			name:     "lines #1",
+			out:      "# queue stats\nQueueDepth gauge 12.5\n\nJobsFailed counter 3\nJobsFailed counter 2\n",
+			gauges:   map[string]agmemory.Gauge{"QueueDepth": 12.5},
+			counters: map[string]agmemory.Counter{"JobsFailed": 5},
+		},
+		{
+			name:     "json array #2",
+			out:      `[{"id":"CertDaysLeft","type":"gauge","value":30},{"id":"Renewals","type":"counter","delta":1}]`,
+			gauges:   map[string]agmemory.Gauge{"CertDaysLeft": 30},
+			counters: map[string]agmemory.Counter{"Renewals": 1},
+		},
+		{
+			name:     "json object #3",
+			out:      `{"id":"CertDaysLeft","type":"gauge","value":30}`,
+			gauges:   map[string]agmemory.Gauge{"CertDaysLeft": 30},
+			counters: map[string]agmemory.Counter{},
+		},
+		{name: "unknown type #4", out: "QueueDepth histogram 1", wantErr: true},
+		{name: "bad counter #5", out: "Jobs counter 1.5", wantErr: true},
+		{name: "missing value #6", out: "QueueDepth gauge", wantErr: true},
+		{name: "json gauge without value #7", out: `[{"id":"CertDaysLeft","type":"gauge"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := collector.ParseExecOutput([]byte(tt.out))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.gauges, m.Gauges)
+			assert.Equal(t, tt.counters, m.Counters)
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	sh := func(script string) collector.ExecCommand {
+		return collector.ExecCommand{Command: []string{"/bin/sh", "-c", script}}
+	}
+	slow := sh("sleep 5; echo Slow gauge 1")
+	slow.Timeout = collector.Duration(100 * time.Millisecond)
+
+	c, err := collector.NewExec(collector.ExecName, time.Second, collector.ExecSettings{
+		Commands:    []collector.ExecCommand{sh("echo QueueDepth gauge 7"), sh("echo Jobs counter 2"), sh("exit 3"), slow},
+		Concurrency: 2,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	m, err := c.Collect(context.Background())
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "timeout")
+	assert.Equal(t, map[string]agmemory.Gauge{"QueueDepth": 7}, m.Gauges)
+	assert.Equal(t, map[string]agmemory.Counter{"Jobs": 2}, m.Counters)
+
+	_, err = collector.NewExec(collector.ExecName, time.Second, collector.ExecSettings{})
+	require.Error(t, err)
+}
+
+func TestPrometheus(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		n := requests.Add(1)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintf(w, `# TYPE requests counter
+requests_total{code="200"} %d
+requests_created{code="200"} 1.7e9
+# TYPE queue gauge
+queue{name="jobs"} %d
+# TYPE latency histogram
+latency_bucket{le="1"} %d
+latency_bucket{le="+Inf"} %d
+latency_sum 2.5
+latency_count %d
+go_goroutines 8
+`, 10*n, n, n, 2*n, 2*n)
+	}))
+	defer srv.Close()
+	instance := strings.TrimPrefix(srv.URL, "http://")
+
+	c, err := collector.NewPrometheus(collector.PrometheusName, time.Second, collector.PrometheusSettings{
+		Targets: []collector.PrometheusTarget{{URL: srv.URL + "/metrics", Labels: map[string]string{"job": "app"}}},
+		Metrics: collector.Filter{Exclude: []string{"go_*"}},
+	})
+	require.NoError(t, err)
+
+	// the first scrape only remembers counters
+	m, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, m.Counters)
+	assert.Equal(t, map[string]agmemory.Gauge{
+		`queue{instance="` + instance + `",job="app",name="jobs"}`: 1,
+		`latency_sum{instance="` + instance + `",job="app"}`:       2.5,
+	}, m.Gauges)
+
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]agmemory.Counter{
+		`requests_total{code="200",instance="` + instance + `",job="app"}`: 10,
+		`latency_bucket{instance="` + instance + `",job="app",le="1"}`:     1,
+		`latency_bucket{instance="` + instance + `",job="app",le="+Inf"}`:  2,
+		`latency_count{instance="` + instance + `",job="app"}`:             2,
+	}, m.Counters)
+	assert.Equal(t, agmemory.Gauge(2), m.Gauges[`queue{instance="`+instance+`",job="app",name="jobs"}`])
+
+	// reset of the target: counters start from zero
+	requests.Store(0)
+	m, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, agmemory.Counter(10), m.Counters[`requests_total{code="200",instance="`+instance+`",job="app"}`])
+
+	c, err = collector.NewPrometheus(collector.PrometheusName, time.Second, collector.PrometheusSettings{
+		Targets: []collector.PrometheusTarget{{URL: srv.URL + "/missing"}}})
+	require.NoError(t, err)
+	_, err = c.Collect(context.Background())
+	assert.ErrorContains(t, err, "404")
+
+	_, err = collector.NewPrometheus(collector.PrometheusName, time.Second, collector.PrometheusSettings{
+		Targets: []collector.PrometheusTarget{{URL: "ftp://localhost/metrics"}}})
+	assert.Error(t, err)
+}
+
+func TestLogTail(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	settings := collector.LogTailSettings{
+		Files: []collector.LogFile{{Path: logFile, Rules: []collector.LogRule{
+			{Regex: `ERROR`, Name: "LogErrors", Type: "counter"},
+			{Regex: `latency=(?P<ms>[0-9.]+)ms`, Name: "LastLatency", Type: "gauge", ValueGroup: "ms"},
+		}}},
+		StateFile: filepath.Join(dir, "state.json"),
+	}
+	appendLog := func(s string) {
+		f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString(s)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	collect := func(c collector.Collector) collector.Metrics {
+		m, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		return m
+	}
+
+	appendLog("ERROR before start\n")
+	c, err := collector.NewLogTail(collector.LogTailName, time.Second, settings)
+	require.NoError(t, err)
+	assert.Empty(t, collect(c).Counters, "test #file is read from the end")
+
+	appendLog("ERROR one\nINFO latency=12.5ms\nERROR two, no newline yet")
+	m := collect(c)
+	assert.Equal(t, map[string]agmemory.Counter{"LogErrors": 1}, m.Counters, "test #new lines")
+	assert.Equal(t, map[string]agmemory.Gauge{"LastLatency": 12.5}, m.Gauges, "test #new lines")
+
+	appendLog("\n")
+	assert.Equal(t, map[string]agmemory.Counter{"LogErrors": 1}, collect(c).Counters, "test #completed line")
+
+	// rotation: the rest of the old file is read before the new file
+	require.NoError(t, os.Rename(logFile, logFile+".1"))
+	f, err := os.OpenFile(logFile+".1", os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("ERROR late write to the old file\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	appendLog("ERROR in the new file\n")
+	assert.Equal(t, map[string]agmemory.Counter{"LogErrors": 2}, collect(c).Counters, "test #rotation")
+
+	// truncation
+	require.NoError(t, os.Truncate(logFile, 0))
+	appendLog("ERROR cut\n") // shorter than the read part of the file
+	assert.Equal(t, map[string]agmemory.Counter{"LogErrors": 1}, collect(c).Counters, "test #truncation")
+
+	// restart: offsets are loaded from the state file
+	appendLog("ERROR while stopped\n")
+	c, err = collector.NewLogTail(collector.LogTailName, time.Second, settings)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]agmemory.Counter{"LogErrors": 1}, collect(c).Counters, "test #restart")
+	assert.Empty(t, collect(c).Counters, "test #nothing new")
+
+	settings.Files[0].Rules = []collector.LogRule{{Regex: `latency`, Name: "LastLatency", Type: "gauge"}}
+	_, err = collector.NewLogTail(collector.LogTailName, time.Second, settings)
+	assert.Error(t, err, "test #gauge without value group")
+}
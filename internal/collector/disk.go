@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// Names of the disk collectors.
+const (
+	DiskName   = "disk"
+	DiskIOName = "diskio"
+)
+
+type (
+	// Disk collects usage of mounted filesystems: DiskTotal, DiskUsed, DiskFree, DiskUsedPercent and
+	// DiskInodesUsedPercent with labels mountpoint and device.
+	Disk struct {
+		base
+		settings DiskSettings
+	}
+
+	// DiskSettings filters of the disk collector.
+	DiskSettings struct {
+		Mounts  Filter `json:"mounts"`
+		Devices Filter `json:"devices"`
+		FSTypes Filter `json:"fstypes"`
+	}
+
+	// DiskIO collects I/O totals of block devices since boot: DiskReadBytes, DiskWriteBytes, DiskReads,
+	// DiskWrites and DiskIOTime (milliseconds) with label device. Totals are gauges, the server adds counters up.
+	DiskIO struct {
+		base
+		settings DiskIOSettings
+	}
+
+	// DiskIOSettings filters of the diskio collector.
+	DiskIOSettings struct {
+		Devices Filter `json:"devices"`
+	}
+)
+
+func init() {
+	Register(DiskName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s DiskSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		if err := errors.Join(s.Mounts.validate(), s.Devices.validate(), s.FSTypes.validate()); err != nil {
+			return nil, err
+		}
+		return NewDisk(name, cfg.Interval, s), nil
+	})
+	Register(DiskIOName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s DiskIOSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		if err := s.Devices.validate(); err != nil {
+			return nil, err
+		}
+		return NewDiskIO(name, cfg.Interval, s), nil
+	})
+}
+
+// NewDisk returns filesystem usage collector.
+func NewDisk(name string, interval time.Duration, settings DiskSettings) *Disk {
+	return &Disk{base: base{name: name, interval: interval}, settings: settings}
+}
+
+func (c *Disk) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return m, err
+	}
+
+	var errs []error
+	for _, p := range partitions {
+		if !c.settings.Mounts.Match(p.Mountpoint) || !c.settings.Devices.Match(p.Device) || !c.settings.FSTypes.Match(p.Fstype) {
+			continue
+		}
+		usage, err := disk.UsageWithContext(ctx, p.Mountpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("usage of %s: %w", p.Mountpoint, err))
+			continue
+		}
+
+		labels := map[string]string{"mountpoint": p.Mountpoint, "device": p.Device}
+		m.Gauges[metricid.Format("DiskTotal", labels)] = agmemory.Gauge(usage.Total)
+		m.Gauges[metricid.Format("DiskUsed", labels)] = agmemory.Gauge(usage.Used)
+		m.Gauges[metricid.Format("DiskFree", labels)] = agmemory.Gauge(usage.Free)
+		m.Gauges[metricid.Format("DiskUsedPercent", labels)] = agmemory.Gauge(usage.UsedPercent)
+		m.Gauges[metricid.Format("DiskInodesUsedPercent", labels)] = agmemory.Gauge(usage.InodesUsedPercent)
+	}
+	return m, errors.Join(errs...)
+}
+
+// NewDiskIO returns block devices I/O collector.
+func NewDiskIO(name string, interval time.Duration, settings DiskIOSettings) *DiskIO {
+	return &DiskIO{base: base{name: name, interval: interval}, settings: settings}
+}
+
+func (c *DiskIO) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return m, err
+	}
+
+	for device, io := range counters {
+		if !c.settings.Devices.Match(device) {
+			continue
+		}
+		labels := map[string]string{"device": device}
+		m.Gauges[metricid.Format("DiskReadBytes", labels)] = agmemory.Gauge(io.ReadBytes)
+		m.Gauges[metricid.Format("DiskWriteBytes", labels)] = agmemory.Gauge(io.WriteBytes)
+		m.Gauges[metricid.Format("DiskReads", labels)] = agmemory.Gauge(io.ReadCount)
+		m.Gauges[metricid.Format("DiskWrites", labels)] = agmemory.Gauge(io.WriteCount)
+		m.Gauges[metricid.Format("DiskIOTime", labels)] = agmemory.Gauge(io.IoTime)
+	}
+	return m, nil
+}
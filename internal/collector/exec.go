@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+)
+
+// ExecName name of the commands collector.
+const ExecName = "exec"
+
+const (
+	defaultExecConcurrency = 4
+	// execWaitDelay how long to wait for output of the command after it is killed on timeout
+	// (children of the command may keep stdout open).
+	execWaitDelay = time.Second
+)
+
+type (
+	// Exec runs the configured commands and parses metrics from their stdout, see ParseExecOutput.
+	// Commands are run in parallel, at most Concurrency at once.
+	Exec struct {
+		base
+		commands    []ExecCommand
+		timeout     time.Duration
+		concurrency int
+	}
+
+	// ExecSettings settings of the exec collector. Timeout is the default timeout of commands,
+	// by default the interval of the collector.
+	ExecSettings struct {
+		Commands    []ExecCommand `json:"commands"`
+		Timeout     Duration      `json:"timeout"`
+		Concurrency int           `json:"concurrency"`
+	}
+
+	// ExecCommand command with arguments, it is run without shell.
+	ExecCommand struct {
+		Command []string `json:"command"`
+		Timeout Duration `json:"timeout"`
+	}
+)
+
+func init() {
+	Register(ExecName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s ExecSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		return NewExec(name, cfg.Interval, s)
+	})
+}
+
+// NewExec returns commands collector.
+func NewExec(name string, interval time.Duration, settings ExecSettings) (*Exec, error) {
+	if len(settings.Commands) == 0 {
+		return nil, errors.New("no commands to run")
+	}
+	for _, cmd := range settings.Commands {
+		if len(cmd.Command) == 0 || cmd.Command[0] == "" {
+			return nil, errors.New("empty command")
+		}
+	}
+
+	c := &Exec{
+		base:        base{name: name, interval: interval},
+		commands:    settings.Commands,
+		timeout:     time.Duration(settings.Timeout),
+		concurrency: settings.Concurrency,
+	}
+	if c.timeout <= 0 {
+		c.timeout = interval
+	}
+	if c.concurrency <= 0 {
+		c.concurrency = defaultExecConcurrency
+	}
+	return c, nil
+}
+
+func (c *Exec) Collect(ctx context.Context) (Metrics, error) {
+	sem := agconfig.NewSemaphore(c.concurrency)
+	results := make([]Metrics, len(c.commands))
+	errs := make([]error, len(c.commands))
+
+	var wg sync.WaitGroup
+	for i, cmd := range c.commands {
+		wg.Add(1)
+		go func(i int, cmd ExecCommand) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			results[i], errs[i] = c.run(ctx, cmd)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("command %q: %w", strings.Join(cmd.Command, " "), errs[i])
+			}
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	m := NewMetrics()
+	for _, r := range results {
+		for k, v := range r.Gauges {
+			m.Gauges[k] = v
+		}
+		for k, v := range r.Counters {
+			m.Counters[k] += v
+		}
+	}
+	return m, errors.Join(errs...)
+}
+
+// run runs one command with its timeout and parses its output.
+func (c *Exec) run(ctx context.Context, command ExecCommand) (Metrics, error) {
+	timeout := time.Duration(command.Timeout)
+	if timeout <= 0 {
+		timeout = c.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command.Command[0], command.Command[1:]...)
+	cmd.WaitDelay = execWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return NewMetrics(), fmt.Errorf("timeout %s: %w", timeout, ctx.Err())
+	}
+	if err != nil {
+		return NewMetrics(), fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return ParseExecOutput(out)
+}
+
+// ParseExecOutput parses metrics from the command output. The output is either JSON of agmemory.Metrics
+// (one object or an array) or lines "name type value", where type is gauge or counter.
+// Empty lines and lines starting with "#" are skipped.
+func ParseExecOutput(out []byte) (Metrics, error) {
+	m := NewMetrics()
+
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var metrics []agmemory.Metrics
+		if trimmed[0] == '{' {
+			metrics = make([]agmemory.Metrics, 1)
+			if err := json.Unmarshal(trimmed, &metrics[0]); err != nil {
+				return m, err
+			}
+		} else if err := json.Unmarshal(trimmed, &metrics); err != nil {
+			return m, err
+		}
+		return m, m.AddJSON(metrics)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return m, fmt.Errorf("line %d: want \"name type value\", got %q", line, text)
+		}
+
+		switch fields[1] {
+		case "gauge":
+			v, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return m, fmt.Errorf("line %d: %w", line, err)
+			}
+			m.Gauges[fields[0]] = agmemory.Gauge(v)
+		case "counter":
+			v, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return m, fmt.Errorf("line %d: %w", line, err)
+			}
+			m.Counters[fields[0]] += agmemory.Counter(v)
+		default:
+			return m, fmt.Errorf("line %d: unknown metric type %q", line, fields[1])
+		}
+	}
+	return m, scanner.Err()
+}
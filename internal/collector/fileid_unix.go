@@ -0,0 +1,16 @@
+//go:build unix
+
+package collector
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns inode of the file, rotation replaces the file with one of a new inode.
+func fileID(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
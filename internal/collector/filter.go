@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"time"
+)
+
+// Duration is time.Duration written in settings as a string, e.g. "5s".
+type Duration time.Duration
+
+// Filter selects names (devices, mountpoints, interfaces) by glob patterns of path.Match:
+// the name is selected if Include is empty or one of its patterns matches, and no pattern of Exclude matches.
+// "*" does not match "/", so "/mnt/*" selects "/mnt/a" but not "/mnt/a/b".
+type Filter struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// Match reports whether the name is selected by the filter.
+func (f Filter) Match(name string) bool {
+	for _, p := range f.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, p := range f.Include {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks syntax of the patterns.
+func (f Filter) validate() error {
+	for _, p := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeSettings decodes settings of the collector config into v, unknown fields are errors.
+// Empty settings keep v unchanged.
+func decodeSettings(settings json.RawMessage, v interface{}) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(settings))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
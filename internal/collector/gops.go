@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// GopsName name of the gopsutil CPU and memory collector.
+const GopsName = "gops"
+
+// cpuPercentInterval how long CPU utilization is measured.
+const cpuPercentInterval = time.Second
+
+// Gops collects per-CPU utilization and total/free memory with gopsutil.
+type Gops struct {
+	base
+}
+
+func init() {
+	Register(GopsName, true, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		return NewGops(name, cfg.Interval), nil
+	})
+}
+
+// NewGops returns gopsutil CPU and memory collector.
+func NewGops(name string, interval time.Duration) *Gops {
+	return &Gops{base: base{name: name, interval: interval}}
+}
+
+func (c *Gops) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+
+	percentage, err := cpu.PercentWithContext(ctx, cpuPercentInterval, true)
+	if err != nil {
+		return m, err
+	}
+	for i, p := range percentage {
+		m.Gauges["CPUutilization"+strconv.Itoa(i+1)] = agmemory.Gauge(p)
+	}
+
+	memory, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return m, err
+	}
+	m.Gauges["TotalMemory"] = agmemory.Gauge(memory.Total)
+	m.Gauges["FreeMemory"] = agmemory.Gauge(memory.Free)
+
+	return m, nil
+}
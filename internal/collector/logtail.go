@@ -0,0 +1,322 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+)
+
+// LogTailName name of the log files collector.
+const LogTailName = "logtail"
+
+// defaultLogTailStateFile file of read offsets.
+const defaultLogTailStateFile = "/tmp/metrics-agent-logtail.json"
+
+type (
+	// LogTail follows log files like "tail -F" and applies rules to every new line: counter rules add 1
+	// (or the captured value) on every matched line, gauge rules set the captured value of the last matched line.
+	// Rotated files are read to the end before the new file; truncated files are read from the beginning
+	// (truncation is noticed if the file is shorter than the read part).
+	// Read offsets are saved in the state file after every collect, so lines are not counted twice after restart
+	// of the agent. Offsets are saved before the counts are sent, so counts which are not sent before the agent
+	// exits are lost: delivery is at most once.
+	LogTail struct {
+		base
+		files         []*tailedFile
+		stateFile     string
+		fromBeginning bool
+	}
+
+	// LogTailSettings settings of the logtail collector. Files without saved offset are read from the end
+	// unless FromBeginning is set.
+	LogTailSettings struct {
+		Files         []LogFile `json:"files"`
+		StateFile     string    `json:"state_file"`
+		FromBeginning bool      `json:"from_beginning"`
+	}
+
+	// LogFile file to follow with rules of its lines.
+	LogFile struct {
+		Path  string    `json:"path"`
+		Rules []LogRule `json:"rules"`
+	}
+
+	// LogRule matches lines by Regex. Type is counter or gauge, ValueGroup is the name of the capture group
+	// with the value (required for gauges).
+	LogRule struct {
+		Regex      string `json:"regex"`
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		ValueGroup string `json:"value_group"`
+	}
+
+	logRule struct {
+		name    string
+		counter bool
+		re      *regexp.Regexp
+		group   int // 0 - no value group
+	}
+
+	tailedFile struct {
+		path    string
+		rules   []logRule
+		f       *os.File
+		info    os.FileInfo
+		state   *logFileState // saved state, used on the first open only
+		started bool          // false until the first collect
+		offset  int64
+	}
+
+	logFileState struct {
+		ID     uint64 `json:"id"`
+		Offset int64  `json:"offset"`
+	}
+)
+
+func init() {
+	Register(LogTailName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s LogTailSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		return NewLogTail(name, cfg.Interval, s)
+	})
+}
+
+// NewLogTail returns log files collector, read offsets are loaded from the state file.
+func NewLogTail(name string, interval time.Duration, settings LogTailSettings) (*LogTail, error) {
+	if len(settings.Files) == 0 {
+		return nil, errors.New("no files to follow")
+	}
+
+	c := &LogTail{base: base{name: name, interval: interval}, stateFile: settings.StateFile, fromBeginning: settings.FromBeginning}
+	if c.stateFile == "" {
+		c.stateFile = defaultLogTailStateFile
+	}
+	state, err := loadLogTailState(c.stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lf := range settings.Files {
+		if lf.Path == "" || len(lf.Rules) == 0 {
+			return nil, errors.New("file path and rules must be set")
+		}
+		tf := &tailedFile{path: lf.Path}
+		if st, ok := state[lf.Path]; ok {
+			tf.state = &st
+		}
+
+		for _, r := range lf.Rules {
+			rule, err := newLogRule(r)
+			if err != nil {
+				return nil, fmt.Errorf("file %s: %w", lf.Path, err)
+			}
+			tf.rules = append(tf.rules, rule)
+		}
+		c.files = append(c.files, tf)
+	}
+	return c, nil
+}
+
+func newLogRule(r LogRule) (logRule, error) {
+	if r.Name == "" {
+		return logRule{}, errors.New("rule name is not set")
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return logRule{}, fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+
+	rule := logRule{name: r.Name, re: re}
+	switch r.Type {
+	case "counter":
+		rule.counter = true
+	case "gauge":
+		if r.ValueGroup == "" {
+			return logRule{}, fmt.Errorf("rule %q: value_group is required for gauge", r.Name)
+		}
+	default:
+		return logRule{}, fmt.Errorf("rule %q: unknown type %q", r.Name, r.Type)
+	}
+	if r.ValueGroup != "" {
+		if rule.group = re.SubexpIndex(r.ValueGroup); rule.group < 0 {
+			return logRule{}, fmt.Errorf("rule %q: no group %q in regex", r.Name, r.ValueGroup)
+		}
+	}
+	return rule, nil
+}
+
+func (c *LogTail) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+	var errs []error
+
+	for _, tf := range c.files {
+		if err := c.follow(tf, m); err != nil {
+			errs = append(errs, fmt.Errorf("file %s: %w", tf.path, err))
+		}
+		tf.started = true
+	}
+	if err := c.saveState(); err != nil {
+		errs = append(errs, err)
+	}
+	return m, errors.Join(errs...)
+}
+
+// follow reads new lines of the file.
+func (c *LogTail) follow(tf *tailedFile, m Metrics) error {
+	fi, statErr := os.Stat(tf.path)
+	if tf.f != nil && (statErr != nil || !os.SameFile(tf.info, fi)) {
+		// rotated: read the rest of the old file, the new one is read from the beginning
+		err := tf.read(m)
+		tf.f.Close()
+		tf.f = nil
+		if err != nil {
+			return err
+		}
+	}
+	if statErr != nil {
+		if errors.Is(statErr, os.ErrNotExist) {
+			return nil // wait for the file
+		}
+		return statErr
+	}
+
+	if tf.f == nil {
+		f, err := os.Open(tf.path)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		tf.f, tf.info = f, info
+
+		switch {
+		case tf.state != nil && tf.state.ID == fileID(info):
+			tf.offset = tf.state.Offset
+		case tf.state != nil: // rotated while the agent was stopped
+			tf.offset = 0
+		case tf.started: // created or rotated after the first collect
+			tf.offset = 0
+		case c.fromBeginning:
+			tf.offset = 0
+		default:
+			tf.offset = info.Size()
+		}
+		tf.state = nil
+	}
+
+	if fi.Size() < tf.offset { // truncated
+		tf.offset = 0
+	}
+	return tf.read(m)
+}
+
+// read applies rules to complete lines after the offset, an incomplete last line is read next time.
+func (tf *tailedFile) read(m Metrics) error {
+	if _, err := tf.f.Seek(tf.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(tf.f)
+	for {
+		line, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		tf.offset += int64(len(line))
+		tf.apply(strings.TrimRight(line, "\r\n"), m)
+	}
+}
+
+// apply applies rules to the line.
+func (tf *tailedFile) apply(line string, m Metrics) {
+	for _, rule := range tf.rules {
+		match := rule.re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		if rule.counter {
+			delta := int64(1)
+			if rule.group > 0 {
+				v, err := strconv.ParseInt(match[rule.group], 10, 64)
+				if err != nil {
+					continue
+				}
+				delta = v
+			}
+			m.Counters[rule.name] += agmemory.Counter(delta)
+			continue
+		}
+
+		if v, err := strconv.ParseFloat(match[rule.group], 64); err == nil {
+			m.Gauges[rule.name] = agmemory.Gauge(v)
+		}
+	}
+}
+
+// saveState writes offsets of open files to the state file.
+func (c *LogTail) saveState() error {
+	state := make(map[string]logFileState, len(c.files))
+	for _, tf := range c.files {
+		if tf.f != nil {
+			state[tf.path] = logFileState{ID: fileID(tf.info), Offset: tf.offset}
+		} else if tf.state != nil {
+			state[tf.path] = *tf.state
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.stateFile), filepath.Base(c.stateFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.stateFile)
+}
+
+// loadLogTailState reads offsets by file path, missing state file is empty state.
+func loadLogTailState(stateFile string) (map[string]logFileState, error) {
+	state := make(map[string]logFileState)
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("bad state file %s: %w", stateFile, err)
+	}
+	return state, nil
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+
+	"github.com/shirou/gopsutil/net"
+)
+
+// NetName name of the network interfaces collector.
+const NetName = "net"
+
+type (
+	// Net collects totals of network interfaces since boot: NetBytesSent, NetBytesRecv, NetPacketsSent,
+	// NetPacketsRecv, NetErrIn, NetErrOut, NetDropIn and NetDropOut with label interface.
+	Net struct {
+		base
+		settings NetSettings
+	}
+
+	// NetSettings filters of the net collector.
+	NetSettings struct {
+		Interfaces Filter `json:"interfaces"`
+	}
+)
+
+func init() {
+	Register(NetName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s NetSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		if err := s.Interfaces.validate(); err != nil {
+			return nil, err
+		}
+		return NewNet(name, cfg.Interval, s), nil
+	})
+}
+
+// NewNet returns network interfaces collector.
+func NewNet(name string, interval time.Duration, settings NetSettings) *Net {
+	return &Net{base: base{name: name, interval: interval}, settings: settings}
+}
+
+func (c *Net) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return m, err
+	}
+
+	for _, io := range counters {
+		if !c.settings.Interfaces.Match(io.Name) {
+			continue
+		}
+		labels := map[string]string{"interface": io.Name}
+		m.Gauges[metricid.Format("NetBytesSent", labels)] = agmemory.Gauge(io.BytesSent)
+		m.Gauges[metricid.Format("NetBytesRecv", labels)] = agmemory.Gauge(io.BytesRecv)
+		m.Gauges[metricid.Format("NetPacketsSent", labels)] = agmemory.Gauge(io.PacketsSent)
+		m.Gauges[metricid.Format("NetPacketsRecv", labels)] = agmemory.Gauge(io.PacketsRecv)
+		m.Gauges[metricid.Format("NetErrIn", labels)] = agmemory.Gauge(io.Errin)
+		m.Gauges[metricid.Format("NetErrOut", labels)] = agmemory.Gauge(io.Errout)
+		m.Gauges[metricid.Format("NetDropIn", labels)] = agmemory.Gauge(io.Dropin)
+		m.Gauges[metricid.Format("NetDropOut", labels)] = agmemory.Gauge(io.Dropout)
+	}
+	return m, nil
+}
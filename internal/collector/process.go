@@ -0,0 +1,229 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// ProcessName name of the processes collector.
+const ProcessName = "process"
+
+type (
+	// Process collects resources of the configured processes, values of all processes matched by one selector
+	// are summed up: ProcessCount, ProcessCPUPercent (since the previous collect), ProcessCPUSeconds, ProcessRSS,
+	// ProcessOpenFDs and ProcessThreads with label process (name of the selector).
+	Process struct {
+		base
+		selectors []processSelector
+		lastCPU   map[int32]cpuSample
+	}
+
+	// ProcessSettings settings of the process collector.
+	ProcessSettings struct {
+		Processes []ProcessSelector `json:"processes"`
+	}
+
+	// ProcessSelector selects processes by one of PIDFile, Pattern (glob of the process name) or Cmdline (regexp),
+	// Name is the label of the metrics.
+	ProcessSelector struct {
+		Name    string `json:"name"`
+		PIDFile string `json:"pid_file"`
+		Pattern string `json:"pattern"`
+		Cmdline string `json:"cmdline"`
+	}
+
+	processSelector struct {
+		ProcessSelector
+		cmdline *regexp.Regexp
+	}
+
+	processStats struct {
+		count      int
+		cpuPercent float64
+		cpuSeconds float64
+		rss        uint64
+		fds        int64
+		threads    int64
+	}
+
+	cpuSample struct {
+		seconds float64
+		at      time.Time
+	}
+)
+
+func init() {
+	Register(ProcessName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s ProcessSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		return NewProcess(name, cfg.Interval, s)
+	})
+}
+
+// NewProcess returns processes collector, every selector must have a name and exactly one way of selection.
+func NewProcess(name string, interval time.Duration, settings ProcessSettings) (*Process, error) {
+	if len(settings.Processes) == 0 {
+		return nil, errors.New("no processes to collect")
+	}
+
+	c := &Process{base: base{name: name, interval: interval}, lastCPU: make(map[int32]cpuSample)}
+	for _, ps := range settings.Processes {
+		if ps.Name == "" {
+			return nil, errors.New("process name is not set")
+		}
+		set := 0
+		for _, v := range []string{ps.PIDFile, ps.Pattern, ps.Cmdline} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("process %q: exactly one of pid_file, pattern or cmdline must be set", ps.Name)
+		}
+
+		sel := processSelector{ProcessSelector: ps}
+		if ps.Pattern != "" {
+			if _, err := path.Match(ps.Pattern, ""); err != nil {
+				return nil, fmt.Errorf("process %q: %w", ps.Name, err)
+			}
+		}
+		if ps.Cmdline != "" {
+			re, err := regexp.Compile(ps.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("process %q: %w", ps.Name, err)
+			}
+			sel.cmdline = re
+		}
+		c.selectors = append(c.selectors, sel)
+	}
+	return c, nil
+}
+
+func (c *Process) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+	now := time.Now()
+
+	var all []*process.Process // listed only if some selector needs it
+	var errs []error
+	seen := make(map[int32]cpuSample)
+
+	for _, sel := range c.selectors {
+		var procs []*process.Process
+		if sel.PIDFile != "" {
+			p, err := processFromPIDFile(ctx, sel.PIDFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("process %q: %w", sel.Name, err))
+			} else {
+				procs = append(procs, p)
+			}
+		} else {
+			if all == nil {
+				var err error
+				if all, err = process.ProcessesWithContext(ctx); err != nil {
+					return m, err
+				}
+			}
+			for _, p := range all {
+				if sel.match(ctx, p) {
+					procs = append(procs, p)
+				}
+			}
+		}
+
+		var st processStats
+		for _, p := range procs {
+			if c.addProcess(ctx, p, now, &st, seen) != nil {
+				continue // the process has exited
+			}
+			st.count++
+		}
+
+		labels := map[string]string{"process": sel.Name}
+		m.Gauges[metricid.Format("ProcessCount", labels)] = agmemory.Gauge(st.count)
+		m.Gauges[metricid.Format("ProcessCPUPercent", labels)] = agmemory.Gauge(st.cpuPercent)
+		m.Gauges[metricid.Format("ProcessCPUSeconds", labels)] = agmemory.Gauge(st.cpuSeconds)
+		m.Gauges[metricid.Format("ProcessRSS", labels)] = agmemory.Gauge(st.rss)
+		m.Gauges[metricid.Format("ProcessOpenFDs", labels)] = agmemory.Gauge(st.fds)
+		m.Gauges[metricid.Format("ProcessThreads", labels)] = agmemory.Gauge(st.threads)
+	}
+
+	c.lastCPU = seen // forget exited processes
+	return m, errors.Join(errs...)
+}
+
+// addProcess adds resources of the process to st.
+func (c *Process) addProcess(ctx context.Context, p *process.Process, now time.Time, st *processStats, seen map[int32]cpuSample) error {
+	times, err := p.TimesWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	memory, err := p.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	threads, err := p.NumThreadsWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	fds, err := p.NumFDsWithContext(ctx)
+	if err != nil {
+		fds = 0 // not permitted for processes of other users
+	}
+
+	cpuSeconds := times.User + times.System
+	if last, ok := c.lastCPU[p.Pid]; ok && now.After(last.at) && cpuSeconds >= last.seconds {
+		st.cpuPercent += (cpuSeconds - last.seconds) / now.Sub(last.at).Seconds() * 100
+	}
+	seen[p.Pid] = cpuSample{seconds: cpuSeconds, at: now}
+
+	st.cpuSeconds += cpuSeconds
+	st.rss += memory.RSS
+	st.fds += int64(fds)
+	st.threads += int64(threads)
+	return nil
+}
+
+// match reports whether the process is selected by name pattern or command line.
+func (sel processSelector) match(ctx context.Context, p *process.Process) bool {
+	if sel.Pattern != "" {
+		name, err := p.NameWithContext(ctx)
+		if err != nil {
+			return false
+		}
+		ok, _ := path.Match(sel.Pattern, name)
+		return ok
+	}
+	cmdline, err := p.CmdlineWithContext(ctx)
+	if err != nil {
+		return false
+	}
+	return sel.cmdline.MatchString(cmdline)
+}
+
+// processFromPIDFile returns the process of PID stored in the file.
+func processFromPIDFile(ctx context.Context, pidFile string) (*process.Process, error) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad pid file %s: %w", pidFile, err)
+	}
+	return process.NewProcessWithContext(ctx, int32(pid))
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+	"github.com/impr0ver/metrics-service/internal/promtext"
+)
+
+// PrometheusName name of the Prometheus endpoints collector.
+const PrometheusName = "prometheus"
+
+// scrapeAccept Accept header of scrape requests.
+const scrapeAccept = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+type (
+	// Prometheus scrapes Prometheus/OpenMetrics text endpoints. Samples keep their names and labels,
+	// label instance is host:port of the target unless it is set in the target labels. Samples are mapped as follows:
+	//
+	//   - gauge, untyped, info and stateset samples, summary quantiles, histogram "_sum" and gauge histogram samples are gauges;
+	//   - counter samples and histogram/summary "_count" and "_bucket" samples are counters. Scraped values are totals,
+	//     the counter is increased by the difference with the previous scrape (by the value itself after reset of the target);
+	//     the first scrape only remembers the values;
+	//   - "_created" samples are skipped.
+	Prometheus struct {
+		base
+		targets []PrometheusTarget
+		metrics Filter
+		client  *http.Client
+		last    map[string]map[string]float64 // counters of the previous scrape by target URL
+	}
+
+	// PrometheusSettings settings of the prometheus collector. Metrics filters metric family names,
+	// Timeout is the scrape timeout, by default the interval of the collector.
+	PrometheusSettings struct {
+		Targets []PrometheusTarget `json:"targets"`
+		Metrics Filter             `json:"metrics"`
+		Timeout Duration           `json:"timeout"`
+	}
+
+	// PrometheusTarget endpoint to scrape with labels added to its samples.
+	PrometheusTarget struct {
+		URL    string            `json:"url"`
+		Labels map[string]string `json:"labels"`
+	}
+)
+
+func init() {
+	Register(PrometheusName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		var s PrometheusSettings
+		if err := decodeSettings(cfg.Settings, &s); err != nil {
+			return nil, err
+		}
+		return NewPrometheus(name, cfg.Interval, s)
+	})
+}
+
+// NewPrometheus returns Prometheus endpoints collector.
+func NewPrometheus(name string, interval time.Duration, settings PrometheusSettings) (*Prometheus, error) {
+	if len(settings.Targets) == 0 {
+		return nil, errors.New("no targets to scrape")
+	}
+	if err := settings.Metrics.validate(); err != nil {
+		return nil, err
+	}
+
+	targets := make([]PrometheusTarget, 0, len(settings.Targets))
+	for _, t := range settings.Targets {
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("target %q: scheme must be http or https", t.URL)
+		}
+
+		labels := map[string]string{"instance": u.Host}
+		for k, v := range t.Labels {
+			labels[k] = v
+		}
+		targets = append(targets, PrometheusTarget{URL: t.URL, Labels: labels})
+	}
+
+	timeout := time.Duration(settings.Timeout)
+	if timeout <= 0 {
+		timeout = interval
+	}
+	return &Prometheus{
+		base:    base{name: name, interval: interval},
+		targets: targets,
+		metrics: settings.Metrics,
+		client:  &http.Client{Timeout: timeout},
+		last:    make(map[string]map[string]float64),
+	}, nil
+}
+
+func (c *Prometheus) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+	var errs []error
+
+	for _, t := range c.targets {
+		samples, err := c.scrape(ctx, t.URL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scrape %s: %w", t.URL, err))
+			continue
+		}
+
+		last, first := c.last[t.URL], false
+		if last == nil {
+			first = true
+		}
+		current := make(map[string]float64)
+
+		for _, s := range samples {
+			if !c.metrics.Match(s.Family) {
+				continue
+			}
+			for k, v := range t.Labels {
+				if _, ok := s.Labels[k]; !ok {
+					s.Labels[k] = v
+				}
+			}
+			id := metricid.Format(s.Name, s.Labels)
+
+			switch sampleKind(s) {
+			case kindGauge:
+				if !math.IsNaN(s.Value) {
+					m.Gauges[id] = agmemory.Gauge(s.Value)
+				}
+			case kindCounter:
+				if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+					continue
+				}
+				current[id] = s.Value
+				if first {
+					continue
+				}
+				prev, ok := last[id]
+				switch {
+				case !ok || s.Value < prev: // new series or reset of the target
+					m.Counters[id] += agmemory.Counter(math.Floor(s.Value))
+				default:
+					m.Counters[id] += agmemory.Counter(math.Floor(s.Value) - math.Floor(prev))
+				}
+			}
+		}
+		c.last[t.URL] = current
+	}
+	return m, errors.Join(errs...)
+}
+
+// scrape gets samples of the target.
+func (c *Prometheus) scrape(ctx context.Context, target string) ([]promtext.Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", scrapeAccept)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", res.Status)
+	}
+	return promtext.Parse(res.Body)
+}
+
+const (
+	kindSkip = iota
+	kindGauge
+	kindCounter
+)
+
+// sampleKind returns how the sample is stored.
+func sampleKind(s promtext.Sample) int {
+	if strings.HasSuffix(s.Name, "_created") && s.Name != s.Family {
+		return kindSkip
+	}
+
+	switch s.Type {
+	case promtext.Counter:
+		return kindCounter
+	case promtext.Histogram, promtext.Summary:
+		if s.Name == s.Family+"_count" || s.Name == s.Family+"_bucket" {
+			return kindCounter
+		}
+		return kindGauge
+	}
+	return kindGauge
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+)
+
+// RuntimeName name of the Go runtime collector.
+const RuntimeName = "runtime"
+
+// Runtime collects Go runtime memory statistics, RandomValue and PollCount.
+type Runtime struct {
+	base
+	rnd *rand.Rand
+}
+
+func init() {
+	Register(RuntimeName, true, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		return NewRuntime(name, cfg.Interval), nil
+	})
+}
+
+// NewRuntime returns Go runtime collector.
+func NewRuntime(name string, interval time.Duration) *Runtime {
+	return &Runtime{base: base{name: name, interval: interval}, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (c *Runtime) Collect(ctx context.Context) (Metrics, error) {
+	var rtm runtime.MemStats
+	runtime.ReadMemStats(&rtm)
+
+	m := NewMetrics()
+	m.Gauges["Alloc"] = agmemory.Gauge(rtm.Alloc)
+	m.Gauges["BuckHashSys"] = agmemory.Gauge(rtm.BuckHashSys)
+	m.Gauges["Frees"] = agmemory.Gauge(rtm.Frees)
+	m.Gauges["GCCPUFraction"] = agmemory.Gauge(rtm.GCCPUFraction)
+	m.Gauges["GCSys"] = agmemory.Gauge(rtm.HeapAlloc)
+	m.Gauges["HeapAlloc"] = agmemory.Gauge(rtm.HeapAlloc)
+	m.Gauges["HeapIdle"] = agmemory.Gauge(rtm.HeapIdle)
+	m.Gauges["HeapInuse"] = agmemory.Gauge(rtm.HeapInuse)
+	m.Gauges["HeapObjects"] = agmemory.Gauge(rtm.HeapObjects)
+	m.Gauges["HeapReleased"] = agmemory.Gauge(rtm.HeapReleased)
+	m.Gauges["HeapSys"] = agmemory.Gauge(rtm.HeapSys)
+	m.Gauges["LastGC"] = agmemory.Gauge(rtm.LastGC)
+	m.Gauges["Lookups"] = agmemory.Gauge(rtm.Lookups)
+	m.Gauges["MCacheInuse"] = agmemory.Gauge(rtm.MCacheInuse)
+	m.Gauges["MCacheSys"] = agmemory.Gauge(rtm.MCacheSys)
+	m.Gauges["MSpanInuse"] = agmemory.Gauge(rtm.MSpanInuse)
+	m.Gauges["MSpanSys"] = agmemory.Gauge(rtm.MSpanSys)
+	m.Gauges["Mallocs"] = agmemory.Gauge(rtm.Mallocs)
+	m.Gauges["NextGC"] = agmemory.Gauge(rtm.NextGC)
+	m.Gauges["NumForcedGC"] = agmemory.Gauge(rtm.NumForcedGC)
+	m.Gauges["NumGC"] = agmemory.Gauge(rtm.NumGC)
+	m.Gauges["OtherSys"] = agmemory.Gauge(rtm.OtherSys)
+	m.Gauges["PauseTotalNs"] = agmemory.Gauge(rtm.PauseTotalNs)
+	m.Gauges["StackInuse"] = agmemory.Gauge(rtm.StackInuse)
+	m.Gauges["StackSys"] = agmemory.Gauge(rtm.StackSys)
+	m.Gauges["Sys"] = agmemory.Gauge(rtm.Sys)
+	m.Gauges["TotalAlloc"] = agmemory.Gauge(rtm.TotalAlloc)
+	m.Gauges["RandomValue"] = agmemory.Gauge(c.rnd.Float64())
+
+	m.Counters["PollCount"] = 1
+	return m, nil
+}
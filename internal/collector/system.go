@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// SystemName name of the load average, uptime and swap collector.
+const SystemName = "system"
+
+// System collects Load1, Load5, Load15, Uptime (seconds), SwapTotal, SwapUsed, SwapFree and SwapUsedPercent.
+type System struct {
+	base
+}
+
+func init() {
+	Register(SystemName, false, func(name string, cfg agconfig.CollectorConfig) (Collector, error) {
+		return NewSystem(name, cfg.Interval), nil
+	})
+}
+
+// NewSystem returns load average, uptime and swap collector.
+func NewSystem(name string, interval time.Duration) *System {
+	return &System{base: base{name: name, interval: interval}}
+}
+
+func (c *System) Collect(ctx context.Context) (Metrics, error) {
+	m := NewMetrics()
+	var errs []error
+
+	if avg, err := load.AvgWithContext(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.Gauges["Load1"] = agmemory.Gauge(avg.Load1)
+		m.Gauges["Load5"] = agmemory.Gauge(avg.Load5)
+		m.Gauges["Load15"] = agmemory.Gauge(avg.Load15)
+	}
+
+	if uptime, err := host.UptimeWithContext(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.Gauges["Uptime"] = agmemory.Gauge(uptime)
+	}
+
+	if swap, err := mem.SwapMemoryWithContext(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.Gauges["SwapTotal"] = agmemory.Gauge(swap.Total)
+		m.Gauges["SwapUsed"] = agmemory.Gauge(swap.Used)
+		m.Gauges["SwapFree"] = agmemory.Gauge(swap.Free)
+		m.Gauges["SwapUsedPercent"] = agmemory.Gauge(swap.UsedPercent)
+	}
+
+	return m, errors.Join(errs...)
+}
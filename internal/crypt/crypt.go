@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"os"
 	"path"
+
+	"google.golang.org/protobuf/proto"
 )
 
 func SignDataWithSHA256(plainText []byte, key string) (string, error) {
@@ -147,3 +149,23 @@ func DecryptPKCS1v15(key *rsa.PrivateKey, cipherText []byte) ([]byte, error) {
 
 	return buffer.Bytes(), nil
 }
+
+// Signature of gRPC requests: metadata keys and algorithm identifiers.
+const (
+	SignatureKey    = "signature"
+	SignatureAlgKey = "signature-alg"
+	// SignatureAlgSHA256PB - HMAC-SHA256 of deterministic protobuf binary encoding of the message.
+	SignatureAlgSHA256PB = "hmac-sha256-pb"
+)
+
+// SignProtoWithSHA256 - signs deterministic protobuf binary encoding of the message. Unlike text output,
+// it does not change between runs, but deterministic encoding is stable only within one version of
+// the protobuf library, so the agent and the server have to be built with the same google.golang.org/protobuf
+// version (the one in go.mod). After updating the library both of them have to be updated together.
+func SignProtoWithSHA256(msg proto.Message, key string) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return SignDataWithSHA256(data, key)
+}
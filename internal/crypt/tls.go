@@ -0,0 +1,160 @@
+package crypt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"time"
+)
+
+// certValidity - lifetime of generated certificates.
+const certValidity = 365 * 24 * time.Hour
+
+// GenCerts - generates CA and server and client certificates signed by it for local TLS and mutual TLS,
+// hosts are DNS names and IP addresses of the server. Files are stored in the outdir directory:
+// ca.pem, ca-key.pem, server.pem, server-key.pem, client.pem, client-key.pem.
+func GenCerts(outdir string, hosts []string) error {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	caTmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "metrics-service CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caCert, err := genCert(outdir, "ca", caTmpl, nil, caKey, nil)
+	if err != nil {
+		return err
+	}
+
+	serverTmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "metrics-service server"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			serverTmpl.IPAddresses = append(serverTmpl.IPAddresses, ip)
+		} else {
+			serverTmpl.DNSNames = append(serverTmpl.DNSNames, h)
+		}
+	}
+	if _, err := genCert(outdir, "server", serverTmpl, caCert, nil, caKey); err != nil {
+		return err
+	}
+
+	clientTmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "metrics-service agent"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	_, err = genCert(outdir, "client", clientTmpl, caCert, nil, caKey)
+	return err
+}
+
+// genCert - signs certificate by parent (self-signed if parent is nil) and stores name.pem and name-key.pem.
+// New key is generated if key is nil.
+func genCert(outdir, name string, tmpl, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	var err error
+	if key == nil {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	tmpl.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = tmpl.NotBefore.Add(certValidity)
+
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if err := os.WriteFile(path.Join(outdir, name+".pem"), certPEM, 0644); err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(path.Join(outdir, name+"-key.pem"), keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certDER)
+}
+
+// ServerTLSConfig - returns server TLS config with certificate and key files.
+// If clientCAFile is set, clients must present certificate signed by this CA (mutual TLS).
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientTLSConfig - returns client TLS config. Server certificate is verified with caFile,
+// or with system roots if caFile is empty. Client certificate (mutual TLS) is used if certFile and keyFile are set.
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// loadCertPool - reads PEM certificates from the file.
+func loadCertPool(p string) (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", p)
+	}
+	return pool, nil
+}
@@ -0,0 +1,91 @@
+package crypt
+
+import (
+	"crypto/tls"
+	"net"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// handshake - runs TLS handshake over loopback connection, the server writes one byte after the handshake.
+// Returns client and server errors.
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (error, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		srv := tls.Server(conn, serverCfg)
+		err = srv.Handshake()
+		if err == nil {
+			_, err = srv.Write([]byte{1})
+		}
+		serverErr <- err
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	cli := tls.Client(conn, clientCfg)
+	err = cli.Handshake()
+	if err == nil {
+		// TLS 1.3 client finishes the handshake before the server checks client certificate
+		_, err = cli.Read(make([]byte, 1))
+	}
+	conn.Close()
+	return err, <-serverErr
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, GenCerts(dir, []string{"localhost", "127.0.0.1"}))
+	file := func(name string) string { return path.Join(dir, name) }
+
+	tests := []struct {
+		name        string
+		clientCA    string // server option, enables mutual TLS
+		clientCert  string
+		clientKey   string
+		serverName  string
+		wantFailure bool
+	}{
+		{"TLS #1", "", "", "", "localhost", false},
+		{"mutual TLS #2", file("ca.pem"), file("client.pem"), file("client-key.pem"), "localhost", false},
+		{"mutual TLS without client certificate #3", file("ca.pem"), "", "", "localhost", true},
+		{"wrong server name #4", "", "", "", "example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverCfg, err := ServerTLSConfig(file("server.pem"), file("server-key.pem"), tt.clientCA)
+			require.NoError(t, err)
+			clientCfg, err := ClientTLSConfig(file("ca.pem"), tt.clientCert, tt.clientKey)
+			require.NoError(t, err)
+			clientCfg.ServerName = tt.serverName
+
+			clientErr, serverErr := handshake(t, serverCfg, clientCfg)
+			if tt.wantFailure {
+				assert.True(t, clientErr != nil || serverErr != nil)
+			} else {
+				assert.NoError(t, clientErr)
+				assert.NoError(t, serverErr)
+			}
+		})
+	}
+
+	_, err := ClientTLSConfig(file("ca-key.pem"), "", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+// Graphite package implements receiver of Carbon plaintext protocol: "path value [timestamp]" lines over TCP.
+// All metrics are stored as gauges. Dotted paths become metric names as is, or are split into
+// a name and labels by templates in the form "[filter] template", for example:
+//
+//	servers.* .host.measurement*
+//
+// Template parts: "measurement" (parts are joined with "."), "measurement*" (the rest of the path),
+// any other word is a label name, an empty part skips the path segment. Filter segments match path segments,
+// "*" matches any segment. The first matching template is used.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+	"github.com/impr0ver/metrics-service/internal/storage"
+)
+
+type (
+	// Template maps path segments to the name and labels.
+	Template struct {
+		filter []string
+		parts  []string
+	}
+
+	// Parser parses lines with templates.
+	Parser struct {
+		templates []Template
+	}
+)
+
+const measurement = "measurement"
+
+// ParseTemplate parses "[filter] template".
+func ParseTemplate(s string) (Template, error) {
+	var t Template
+
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		t.parts = strings.Split(fields[0], ".")
+	case 2:
+		t.filter = strings.Split(fields[0], ".")
+		t.parts = strings.Split(fields[1], ".")
+	default:
+		return t, fmt.Errorf("bad template %q", s)
+	}
+
+	hasMeasurement := false
+	for i, p := range t.parts {
+		if p == measurement+"*" && i != len(t.parts)-1 {
+			return t, fmt.Errorf("bad template %q: %q must be the last part", s, p)
+		}
+		if p == measurement || p == measurement+"*" {
+			hasMeasurement = true
+		}
+	}
+	if !hasMeasurement {
+		return t, fmt.Errorf("bad template %q: no measurement", s)
+	}
+	return t, nil
+}
+
+// NewParser return Parser with templates.
+func NewParser(templates []string) (*Parser, error) {
+	p := &Parser{}
+	for _, s := range templates {
+		t, err := ParseTemplate(s)
+		if err != nil {
+			return nil, err
+		}
+		p.templates = append(p.templates, t)
+	}
+	return p, nil
+}
+
+// match checks filter of the template.
+func (t Template) match(segments []string) bool {
+	if len(t.filter) > len(segments) {
+		return false
+	}
+	for i, f := range t.filter {
+		if f != "*" && f != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns name and labels of the path.
+func (t Template) apply(segments []string) (string, map[string]string) {
+	var name []string
+	labels := make(map[string]string)
+
+	for i, p := range t.parts {
+		if i >= len(segments) {
+			break
+		}
+		switch p {
+		case "":
+		case measurement:
+			name = append(name, segments[i])
+		case measurement + "*":
+			name = append(name, segments[i:]...)
+		default:
+			labels[p] = segments[i]
+		}
+	}
+	return strings.Join(name, "."), labels
+}
+
+// MetricID returns metric ID for the path, see metricid.Format.
+func (p *Parser) MetricID(path string) string {
+	segments := strings.Split(path, ".")
+	for _, t := range p.templates {
+		if t.match(segments) {
+			name, labels := t.apply(segments)
+			if name != "" {
+				return metricid.Format(name, labels)
+			}
+		}
+	}
+	return path
+}
+
+// ParseLine parses "path value [timestamp]" and returns metric ID and value.
+func (p *Parser) ParseLine(line string) (string, float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", 0, fmt.Errorf("bad line %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) {
+		return "", 0, fmt.Errorf("bad value %q", fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return "", 0, fmt.Errorf("bad timestamp %q", fields[2])
+		}
+	}
+	return p.MetricID(fields[0]), value, nil
+}
+
+// ListenAndServe listens on TCP address and serves connections until ctx is done.
+func ListenAndServe(ctx context.Context, address string, p *Parser, ms storage.MemoryStoragerInterface) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("graphite listen %s: %w", address, err)
+	}
+	return Serve(ctx, ln, p, ms)
+}
+
+// Serve accepts connections from ln until ctx is done. Listener and connections are closed on return.
+func Serve(ctx context.Context, ln net.Listener, p *Parser, ms storage.MemoryStoragerInterface) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer ln.Close()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(ctx, conn, p, ms)
+		}()
+	}
+}
+
+// serveConn reads lines from one connection and updates gauges.
+func serveConn(ctx context.Context, conn net.Conn, p *Parser, ms storage.MemoryStoragerInterface) {
+	var sLogger = logger.NewLogger()
+
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-connCtx.Done()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		id, value, err := p.ParseLine(line)
+		if err != nil {
+			sLogger.Infof("graphite: %v", err)
+			continue
+		}
+		if err := ms.UpdateGauge(connCtx, id, storage.Gauge(value)); err != nil {
+			sLogger.Errorf("graphite: update gauge %s, %v", id, err)
+		}
+	}
+}
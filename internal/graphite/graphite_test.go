@@ -0,0 +1,95 @@
+package graphite
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserMetricID(t *testing.T) {
+	p, err := NewParser([]string{
+		"servers.* .host.measurement*",
+		"*.app.* env.app.measurement.",
+		"measurement.measurement.region",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"filter and rest of path #1", "servers.srv1.cpu.load", `cpu.load{host="srv1"}`},
+		{"skipped segment #2", "prod.app.requests.total", `requests{app="app",env="prod"}`},
+		{"default template #3", "disk.used.eu", `disk.used{region="eu"}`},
+		{"short path #4", "disk.used", "disk.used"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.MetricID(tt.path))
+		})
+	}
+
+	_, err = NewParser([]string{"host.region"})
+	assert.Error(t, err, "test #no measurement")
+	_, err = NewParser([]string{"host.measurements.measurement_type"})
+	assert.Error(t, err, "test #tags with measurement prefix are not measurement")
+	_, err = NewParser([]string{"measurement*.host"})
+	assert.Error(t, err, "test #measurement* not last")
+}
+
+func TestParseLine(t *testing.T) {
+	p, err := NewParser(nil)
+	require.NoError(t, err)
+
+	id, value, err := p.ParseLine("servers.srv1.cpu 12.5 1700000000")
+	require.NoError(t, err)
+	assert.Equal(t, "servers.srv1.cpu", id)
+	assert.Equal(t, 12.5, value)
+
+	for _, line := range []string{"servers.srv1.cpu", "servers.srv1.cpu abc 1700000000", "servers.srv1.cpu 1 abc", "a 1 2 3"} {
+		_, _, err := p.ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+
+	p, err := NewParser([]string{"servers.* .host.measurement*"})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, ln, p, ms)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("servers.srv1.cpu.load 0.75 1700000000\nbad\nservers.srv2.cpu.load 1.5 1700000000\n"))
+	require.NoError(t, err)
+	conn.Close()
+
+	assert.Eventually(t, func() bool {
+		v, err := ms.GetGaugeByKey(ctx, `cpu.load{host="srv2"}`)
+		return err == nil && v == 1.5
+	}, time.Second, 10*time.Millisecond)
+
+	v, err := ms.GetGaugeByKey(ctx, `cpu.load{host="srv1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Gauge(0.75), v)
+
+	cancel()
+	require.NoError(t, <-done)
+}
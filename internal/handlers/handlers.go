@@ -12,33 +12,71 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/impr0ver/metrics-service/internal/crypt"
 	"github.com/impr0ver/metrics-service/internal/gzip"
+	"github.com/impr0ver/metrics-service/internal/health"
+	"github.com/impr0ver/metrics-service/internal/idempotency"
+	"github.com/impr0ver/metrics-service/internal/lineproto"
 	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+	"github.com/impr0ver/metrics-service/internal/otlp"
+	"github.com/impr0ver/metrics-service/internal/prompb"
 	proto "github.com/impr0ver/metrics-service/internal/rpc"
 	"github.com/impr0ver/metrics-service/internal/servconfig"
 	"github.com/impr0ver/metrics-service/internal/storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang/snappy"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 
 	"google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	status "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
-type RPC struct {
-	proto.UnimplementedMetricsExhangeServer
-	servconfig.Config
-	Ms storage.MemoryStoragerInterface
-}
+type (
+	RPC struct {
+		proto.UnimplementedMetricsExhangeServer
+		servconfig.Config
+		Ms storage.MemoryStoragerInterface
+		// Idem keeps idempotency keys of stream batches, nil disables deduplication of StreamUpdates.
+		Idem idempotency.Store
+	}
+
+	// idempotencyWriter passes the response through and keeps a copy of it for idempotency.Store.
+	idempotencyWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+
+	// verifyStream checks signature of every received StreamBatch.
+	verifyStream struct {
+		grpc.ServerStream
+		cfg servconfig.Config
+	}
+
+	// decryptStream decrypts CryptMetrics of every received StreamBatch.
+	decryptStream struct {
+		grpc.ServerStream
+		privateKey *rsa.PrivateKey
+	}
+)
 
 const (
 	mType   = "mtype"
@@ -48,6 +86,12 @@ const (
 	gauge   = "gauge"
 )
 
+// GetAll page size.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
 var (
 	signKey           string                         // secret key from servconfig
 	defaultCtxTimeout = servconfig.DefaultCtxTimeout // default context timeout from servconfig
@@ -137,6 +181,82 @@ func (r RPC) CryptUpdates(ctx context.Context, cm *proto.CryptMetrics) (*proto.M
 	return &res, nil
 }
 
+// StreamUpdates receives metric batches until the client closes the stream.
+// Every batch is acknowledged with its sequence number and the error text if the batch is not applied.
+// A batch with an already applied idempotency key is acknowledged without applying it again.
+func (r RPC) StreamUpdates(stream proto.MetricsExhange_StreamUpdatesServer) error {
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := proto.StreamAck{Seq: batch.Seq}
+		ack.Error, err = r.applyStreamBatch(stream.Context(), batch)
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(&ack); err != nil {
+			return err
+		}
+	}
+}
+
+// applyStreamBatch applies the batch once per idempotency key and returns the error text for the acknowledgement.
+// The error ends the stream: the batch with the same key is in progress or the store is not available,
+// so the client has to send the batch again.
+func (r RPC) applyStreamBatch(ctx context.Context, batch *proto.StreamBatch) (string, error) {
+	key := batch.GetIdempotencyKey()
+	if key == "" || r.Idem == nil || r.IdempotencyWindow <= 0 {
+		return r.updateStreamBatch(ctx, batch), nil
+	}
+	key = proto.MetricsExhange_StreamUpdates_FullMethodName + ":" + key
+
+	saved, err := r.Idem.Begin(ctx, key, r.IdempotencyWindow)
+	if errors.Is(err, idempotency.ErrInProgress) {
+		return "", status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return "", status.Errorf(codes.Unavailable, "idempotency store error: %v", err)
+	}
+	if saved != nil {
+		return "", nil // already applied
+	}
+
+	ackErr := r.updateStreamBatch(ctx, batch)
+	if ackErr == "" {
+		err = r.Idem.Complete(ctx, key, idempotency.Response{Status: http.StatusOK})
+	} else {
+		err = r.Idem.Release(ctx, key)
+	}
+	if err != nil {
+		sLogger := logger.NewLogger()
+		sLogger.Errorf("StreamUpdates: idempotency store error, %v", err)
+	}
+	return ackErr, nil
+}
+
+// updateStreamBatch applies metrics of the batch and returns the error text, empty if the batch is applied.
+func (r RPC) updateStreamBatch(ctx context.Context, batch *proto.StreamBatch) string {
+	metrics := batch.GetMetrics()
+	if batch.Crypt != nil {
+		metrics = &proto.MetricsArray{}
+		if err := json.Unmarshal(batch.Crypt.Plainbuff, metrics); err != nil {
+			return fmt.Sprintf("can not unmarshal send data: %v", err)
+		}
+	}
+	if len(metrics.GetMetrics()) > 0 {
+		if _, err := r.Updates(ctx, metrics); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
 func (r RPC) GetValue(ctx context.Context, m *proto.Metrics) (*proto.Metrics, error) {
 	var metric proto.Metrics
 	metric.Id = m.Id
@@ -163,6 +283,105 @@ func (r RPC) GetValue(ctx context.Context, m *proto.Metrics) (*proto.Metrics, er
 	return &metric, nil
 }
 
+// GetAll returns page of metrics filtered by type and id prefix, sorted by id (gauge before counter with the same id).
+// Page token is the offset of the next page.
+func (r RPC) GetAll(ctx context.Context, req *proto.GetAllRequest) (*proto.GetAllResponse, error) {
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, status.Errorf(codes.InvalidArgument, "negative page size")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	offset := 0
+	if req.PageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(req.PageToken)
+		if err != nil || offset < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "bad page token %q", req.PageToken)
+		}
+	}
+
+	all, err := r.allMetrics(ctx, req.Mtype)
+	if err != nil {
+		return nil, err
+	}
+	metrics := all[:0]
+	for _, m := range all {
+		if strings.HasPrefix(m.Id, req.Prefix) {
+			metrics = append(metrics, m)
+		}
+	}
+
+	res := proto.GetAllResponse{}
+	if offset >= len(metrics) {
+		return &res, nil
+	}
+	end := offset + pageSize
+	if end < len(metrics) {
+		res.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(metrics)
+	}
+	res.Metrics = metrics[offset:end]
+	return &res, nil
+}
+
+// GetMany returns metrics of both types with the requested ids, unknown ids are skipped.
+func (r RPC) GetMany(ctx context.Context, req *proto.GetManyRequest) (*proto.MetricsArray, error) {
+	ids := make(map[string]bool, len(req.Ids))
+	for _, id := range req.Ids {
+		ids[id] = true
+	}
+
+	all, err := r.allMetrics(ctx, proto.Metrics_UNSPECIFIED)
+	if err != nil {
+		return nil, err
+	}
+	res := proto.MetricsArray{}
+	for _, m := range all {
+		if ids[m.Id] {
+			res.Metrics = append(res.Metrics, m)
+		}
+	}
+	return &res, nil
+}
+
+// allMetrics returns sorted metrics of the type, UNSPECIFIED - of both types.
+func (r RPC) allMetrics(ctx context.Context, mtype proto.Metrics_MetricType) ([]*proto.Metrics, error) {
+	var metrics []*proto.Metrics
+
+	if mtype == proto.Metrics_UNSPECIFIED || mtype == proto.Metrics_GAUGE {
+		gauges, err := r.Ms.GetAllGauges(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "internal error %v", err)
+		}
+		for id, v := range gauges {
+			metrics = append(metrics, &proto.Metrics{Id: id, Mtype: proto.Metrics_GAUGE, Value: float64(v)})
+		}
+	}
+	if mtype == proto.Metrics_UNSPECIFIED || mtype == proto.Metrics_COUNTER {
+		counters, err := r.Ms.GetAllCounters(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "internal error %v", err)
+		}
+		for id, v := range counters {
+			metrics = append(metrics, &proto.Metrics{Id: id, Mtype: proto.Metrics_COUNTER, Delta: int64(v)})
+		}
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Id != metrics[j].Id {
+			return metrics[i].Id < metrics[j].Id
+		}
+		return metrics[i].Mtype < metrics[j].Mtype
+	})
+	return metrics, nil
+}
+
 // MetricsHandlerPost endpoint handler "/update/{mtype}/{mname}/{mvalue}" metric update.
 // Type can take two values: "gauge" or "counter".
 func MetricsHandlerPost(memStor storage.MemoryStoragerInterface) http.HandlerFunc {
@@ -506,6 +725,186 @@ func MetricsHandlerPostBatch(memStor storage.MemoryStoragerInterface) http.Handl
 	}
 }
 
+// MetricsHandlerInfluxWrite endpoint handler "/api/v2/write" and "/write", metrics update in InfluxDB line protocol.
+// Integer fields are added to counters, float and boolean fields update gauges, string fields are skipped.
+// Metric ID is "measurement_field" ("measurement" for the field "value") with tags as labels, see metricid.Format.
+func MetricsHandlerInfluxWrite(memStor storage.MemoryStoragerInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		points, err := lineproto.Parse(r.Body, r.URL.Query().Get("precision"))
+		if err != nil {
+			writeError(err, http.StatusBadRequest, w)
+			return
+		}
+
+		allMetrics := make([]storage.Metrics, 0, len(points))
+		for _, p := range points {
+			for field, f := range p.Fields {
+				name := p.Measurement
+				if field != "value" {
+					name += "_" + field
+				}
+				metric := storage.Metrics{ID: metricid.Format(name, p.Tags)}
+
+				switch f.Type {
+				case lineproto.Integer:
+					delta := f.Int
+					metric.MType, metric.Delta = counter, &delta
+				case lineproto.Unsigned:
+					if f.Uint > math.MaxInt64 {
+						writeError(fmt.Errorf("field %s: value out of range", field), http.StatusBadRequest, w)
+						return
+					}
+					delta := int64(f.Uint)
+					metric.MType, metric.Delta = counter, &delta
+				case lineproto.Float:
+					value := f.Float
+					metric.MType, metric.Value = gauge, &value
+				case lineproto.Boolean:
+					value := 0.0
+					if f.Bool {
+						value = 1
+					}
+					metric.MType, metric.Value = gauge, &value
+				default:
+					continue
+				}
+				allMetrics = append(allMetrics, metric)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultCtxTimeout)
+		defer cancel()
+
+		err = memStor.AddNewMetricsAsBatch(ctx, allMetrics)
+		if err != nil {
+			writeError(err, http.StatusInternalServerError, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MetricsHandlerRemoteWrite endpoint handler "/api/v1/write", Prometheus remote write (snappy-compressed protobuf WriteRequest).
+// Every time series is stored as gauge with the latest sample value: Prometheus counters are cumulative,
+// so they are kept as is instead of being added. Label "__name__" is the metric name, other labels are
+// the metric labels, see metricid.Format. Stale markers (NaN) are skipped.
+func MetricsHandlerRemoteWrite(memStor storage.MemoryStoragerInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(err, http.StatusBadRequest, w)
+			return
+		}
+		reqBuf, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			writeError(err, http.StatusBadRequest, w)
+			return
+		}
+		var req prompb.WriteRequest
+		if err := protobuf.Unmarshal(reqBuf, &req); err != nil {
+			writeError(err, http.StatusBadRequest, w)
+			return
+		}
+
+		allMetrics := make([]storage.Metrics, 0, len(req.Timeseries))
+		for _, ts := range req.Timeseries {
+			var name string
+			labels := make(map[string]string, len(ts.Labels))
+			for _, l := range ts.Labels {
+				if l.Name == "__name__" {
+					name = l.Value
+				} else {
+					labels[l.Name] = l.Value
+				}
+			}
+			if name == "" {
+				writeError(errors.New("time series without __name__ label"), http.StatusBadRequest, w)
+				return
+			}
+
+			var last *prompb.Sample
+			for _, sample := range ts.Samples {
+				if math.IsNaN(sample.Value) {
+					continue
+				}
+				if last == nil || sample.Timestamp >= last.Timestamp {
+					last = sample
+				}
+			}
+			if last == nil {
+				continue
+			}
+
+			value := last.Value
+			allMetrics = append(allMetrics, storage.Metrics{ID: metricid.Format(name, labels), MType: gauge, Value: &value})
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultCtxTimeout)
+		defer cancel()
+
+		err = memStor.AddNewMetricsAsBatch(ctx, allMetrics)
+		if err != nil {
+			writeError(err, http.StatusInternalServerError, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MetricsHandlerOTLP endpoint handler "/v1/metrics", OTLP/HTTP export request in protobuf ("application/x-protobuf")
+// or JSON ("application/json") encoding, see otlp package for metrics mapping. The response has the same encoding.
+// Last values of cumulative counters are kept by the handler, see otlp.Cumulative.
+func MetricsHandlerOTLP(memStor storage.MemoryStoragerInterface) http.HandlerFunc {
+	cum := otlp.NewCumulative()
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		isJSON := strings.HasPrefix(contentType, "application/json")
+		if !isJSON && !strings.HasPrefix(contentType, "application/x-protobuf") {
+			writeError(fmt.Errorf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType, w)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(err, http.StatusBadRequest, w)
+			return
+		}
+		var req colmetricspb.ExportMetricsServiceRequest
+		if isJSON {
+			err = protojson.Unmarshal(body, &req)
+		} else {
+			err = protobuf.Unmarshal(body, &req)
+		}
+		if err != nil {
+			writeError(err, http.StatusBadRequest, w)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultCtxTimeout)
+		defer cancel()
+
+		if err := otlp.Store(ctx, memStor, cum, &req); err != nil {
+			writeError(err, http.StatusInternalServerError, w)
+			return
+		}
+
+		var resp []byte
+		if isJSON {
+			w.Header().Set("Content-Type", "application/json")
+			resp, err = protojson.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+		} else {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			resp, err = protobuf.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+		}
+		if err != nil {
+			writeError(err, http.StatusInternalServerError, w)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+	}
+}
+
 // DataBasePing endpoint handler "/ping", checks for a connection to the database.
 func DataBasePing(memStor storage.MemoryStoragerInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -521,6 +920,44 @@ func DataBasePing(memStor storage.MemoryStoragerInterface) http.HandlerFunc {
 	}
 }
 
+// HealthzHandler endpoint handler "/healthz", liveness probe: the server is running.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+	}
+}
+
+// ReadyzHandler endpoint handler "/readyz", readiness probe: all dependencies are serving.
+// Response has status of every dependency, "ok" or the error text, 503 if any dependency fails.
+func ReadyzHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), defaultCtxTimeout)
+		defer cancel()
+
+		res := struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}{Status: "ok", Checks: make(map[string]string)}
+		httpStatus := http.StatusOK
+
+		for name, err := range checker.CheckAll(ctx) {
+			if err != nil {
+				res.Checks[name] = err.Error()
+				res.Status = "unavailable"
+				httpStatus = http.StatusServiceUnavailable
+			} else {
+				res.Checks[name] = "ok"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(httpStatus)
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
 // gzipMiddleware compress and decompress data on middleware.
 func gzipMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -592,6 +1029,7 @@ func DecriptDataMiddleware(privateKey *rsa.PrivateKey) func(http.Handler) http.H
 				ct := r.Header.Get("Content-type")
 				if ct != "application/octet-stream" {
 					next.ServeHTTP(w, r)
+					return
 				}
 				ciphertext, err := io.ReadAll(r.Body)
 				if err != nil {
@@ -644,6 +1082,77 @@ func CheckIPMiddleware(trustedSubnet string) func(next http.Handler) http.Handle
 	}
 }
 
+// NewIdempotencyStore returns the storage itself if it can keep idempotency keys (db), otherwise a store in memory.
+func NewIdempotencyStore(memStor storage.MemoryStoragerInterface) idempotency.Store {
+	if store, ok := memStor.(idempotency.Store); ok {
+		return store
+	}
+	return idempotency.NewMemoryStore()
+}
+
+func (iw *idempotencyWriter) WriteHeader(statusCode int) {
+	iw.status = statusCode
+	iw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (iw *idempotencyWriter) Write(p []byte) (int, error) {
+	iw.body.Write(p)
+	return iw.ResponseWriter.Write(p)
+}
+
+// IdempotencyMiddleware replays the saved response if a request with the same "Idempotency-Key" was already processed.
+// Only successful (2xx) responses are saved, after an error the client can repeat the request with the same key.
+func IdempotencyMiddleware(store idempotency.Store, window time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotency.HeaderName)
+			if key == "" || window <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = r.URL.Path + ":" + key
+
+			ctx, cancel := context.WithTimeout(r.Context(), defaultCtxTimeout)
+			defer cancel()
+
+			saved, err := store.Begin(ctx, key, window)
+			if errors.Is(err, idempotency.ErrInProgress) {
+				writeError(err, http.StatusConflict, w)
+				return
+			}
+			if err != nil {
+				writeError(err, http.StatusInternalServerError, w)
+				return
+			}
+			if saved != nil {
+				if saved.ContentType != "" {
+					w.Header().Set("Content-Type", saved.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(saved.Status)
+				w.Write(saved.Body)
+				return
+			}
+
+			iw := &idempotencyWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(iw, r)
+
+			// the update is already applied, so the result is saved even if the client is gone
+			ctx, cancel = context.WithTimeout(context.Background(), defaultCtxTimeout)
+			defer cancel()
+			if iw.status >= 200 && iw.status < 300 {
+				err = store.Complete(ctx, key, idempotency.Response{Status: iw.status, ContentType: w.Header().Get("Content-Type"), Body: iw.body.Bytes()})
+			} else {
+				err = store.Release(ctx, key)
+			}
+			if err != nil {
+				sLogger := logger.NewLogger()
+				sLogger.Errorf("idempotencyMiddleware: store error, %v", err)
+			}
+		})
+	}
+}
+
 // ChiRouter initializing and setting up the router.
 func ChiRouter(memStor storage.MemoryStoragerInterface, cfg *servconfig.Config) *chi.Mux {
 	r := chi.NewRouter()
@@ -652,57 +1161,192 @@ func ChiRouter(memStor storage.MemoryStoragerInterface, cfg *servconfig.Config)
 
 	r.Use(middleware.Logger) // replace my custom logger on chi middleware logger
 
-	// Middleware sequence:
-	// 1. Check remote IP for access;
-	// 2. Check verify sending data;
-	// 3. Decrypt data if "PrivateKey" is set (RSA with PKCS1v15);
-	// 4. Gzip/ungzip data.
-	r.Use(CheckIPMiddleware(cfg.TrustedSubnet), VerifyDataMiddleware, DecriptDataMiddleware(cfg.PrivateKey), gzipMiddleware)
+	// Probes for orchestrators, without access checks.
+	r.Get("/healthz", HealthzHandler())
+	r.Get("/readyz", ReadyzHandler(health.NewChecker(cfg, memStor)))
+
+	r.Group(func(r chi.Router) {
+		// Middleware sequence:
+		// 1. Check remote IP for access;
+		// 2. Check verify sending data;
+		// 3. Decrypt data if "PrivateKey" is set (RSA with PKCS1v15);
+		// 4. Gzip/ungzip data.
+		r.Use(CheckIPMiddleware(cfg.TrustedSubnet), VerifyDataMiddleware, DecriptDataMiddleware(cfg.PrivateKey), gzipMiddleware)
+
+		r.Mount("/debug", middleware.Profiler()) // add pprof via chi
+
+		// Repeated updates with the same "Idempotency-Key" are not applied twice.
+		idem := IdempotencyMiddleware(NewIdempotencyStore(memStor), cfg.IdempotencyWindow)
+
+		// Handlers.
+		r.With(idem).Post("/update/{mtype}/{mname}/{mvalue}", MetricsHandlerPost(memStor))
+		r.Get("/value/{mtype}/{mname}", MetricsHandlerGet(memStor))
+		r.Get("/", MetricsHandlerGetAll(memStor))
+		r.Post("/value/", MetricsHandlerGetJSON(memStor))
+		r.With(idem).Post("/update/", MetricsHandlerPostJSON(memStor))
+		r.Get("/ping", DataBasePing(memStor))
+		r.With(idem).Post("/updates/", MetricsHandlerPostBatch(memStor))
+		r.With(idem).Post("/api/v2/write", MetricsHandlerInfluxWrite(memStor))
+		r.With(idem).Post("/write", MetricsHandlerInfluxWrite(memStor))
+		r.Post("/api/v1/write", MetricsHandlerRemoteWrite(memStor))
+		r.Post("/v1/metrics", MetricsHandlerOTLP(memStor))
+		// RPC methods as JSON over HTTP, static routes above (like /api/v1/write) take precedence.
+		r.With(idem).Handle("/api/v1/*", GatewayHandler(*cfg, RPC{Config: *cfg, Ms: memStor}))
+	})
 
-	r.Mount("/debug", middleware.Profiler()) // add pprof via chi
+	return r
+}
 
-	// Handlers.
-	r.Post("/update/{mtype}/{mname}/{mvalue}", MetricsHandlerPost(memStor))
-	r.Get("/value/{mtype}/{mname}", MetricsHandlerGet(memStor))
-	r.Get("/", MetricsHandlerGetAll(memStor))
-	r.Post("/value/", MetricsHandlerGetJSON(memStor))
-	r.Post("/update/", MetricsHandlerPostJSON(memStor))
-	r.Get("/ping", DataBasePing(memStor))
-	r.Post("/updates/", MetricsHandlerPostBatch(memStor))
+// GatewayHandler returns REST/JSON gateway of the RPC server, routes are defined by google.api.http options in rpc.proto.
+// JSON fields are named as in rpc.proto (next_page_token), unset fields are written with zero values.
+// The gateway calls the server in-process, so the checks of gRPC interceptors are made by the gateway itself:
+// the signature from "Grpc-Metadata-Signature-Alg" and "Grpc-Metadata-Signature" headers is verified and
+// CryptMetrics are decrypted, plainbuff sent by the client is rejected.
+func GatewayHandler(c servconfig.Config, server proto.MetricsExhangeServer) http.Handler {
+	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}))
+	gw := gatewayServer{
+		MetricsExhangeServer: server,
+		interceptors:         []grpc.UnaryServerInterceptor{rejectPlainbuffInterceptor, VerifyDataInterceptor(c), DecryptDataInterceptor(c)},
+	}
+	if err := proto.RegisterMetricsExhangeHandlerServer(context.Background(), mux, gw); err != nil {
+		logger.NewLogger().Panic(err)
+	}
+	return mux
+}
 
-	return r
+// gatewayServer calls methods of the server through interceptors, like the gRPC server does.
+type gatewayServer struct {
+	proto.MetricsExhangeServer
+	interceptors []grpc.UnaryServerInterceptor
+}
+
+// gatewayCall calls fn through interceptors of the gateway.
+func gatewayCall[Req, Resp any](g gatewayServer, ctx context.Context, method string, req Req, fn func(context.Context, Req) (Resp, error)) (Resp, error) {
+	info := &grpc.UnaryServerInfo{Server: g.MetricsExhangeServer, FullMethod: method}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return fn(ctx, req.(Req))
+	}
+	for i := len(g.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := g.interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return resp.(Resp), nil
+}
+
+func (g gatewayServer) Update(ctx context.Context, m *proto.Metrics) (*proto.MetricsUpdateResponse, error) {
+	return gatewayCall(g, ctx, proto.MetricsExhange_Update_FullMethodName, m, g.MetricsExhangeServer.Update)
+}
+
+func (g gatewayServer) Updates(ctx context.Context, m *proto.MetricsArray) (*proto.MetricsUpdatesResponse, error) {
+	return gatewayCall(g, ctx, proto.MetricsExhange_Updates_FullMethodName, m, g.MetricsExhangeServer.Updates)
 }
 
+func (g gatewayServer) GetValue(ctx context.Context, m *proto.Metrics) (*proto.Metrics, error) {
+	return gatewayCall(g, ctx, proto.MetricsExhange_GetValue_FullMethodName, m, g.MetricsExhangeServer.GetValue)
+}
+
+func (g gatewayServer) CryptUpdates(ctx context.Context, cm *proto.CryptMetrics) (*proto.MetricsUpdatesResponse, error) {
+	return gatewayCall(g, ctx, proto.MetricsExhange_CryptUpdates_FullMethodName, cm, g.MetricsExhangeServer.CryptUpdates)
+}
+
+func (g gatewayServer) GetAll(ctx context.Context, req *proto.GetAllRequest) (*proto.GetAllResponse, error) {
+	return gatewayCall(g, ctx, proto.MetricsExhange_GetAll_FullMethodName, req, g.MetricsExhangeServer.GetAll)
+}
+
+func (g gatewayServer) GetMany(ctx context.Context, req *proto.GetManyRequest) (*proto.MetricsArray, error) {
+	return gatewayCall(g, ctx, proto.MetricsExhange_GetMany_FullMethodName, req, g.MetricsExhangeServer.GetMany)
+}
+
+// rejectPlainbuffInterceptor rejects CryptMetrics with plainbuff: it is filled only by decryption on the server,
+// otherwise the client could send metrics without encryption.
+func rejectPlainbuffInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if cm, ok := req.(*proto.CryptMetrics); ok && len(cm.Plainbuff) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "plainbuff is set by the server, send cryptbuff")
+	}
+	return handler(ctx, req)
+}
+
+// LoggingInterceptor logs requests. Health checks are not logged, probes call them every few seconds.
 func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
 	var sLogger = logger.NewLogger()
 	sLogger.Infof("FullMethod: %s, Received request: %v", info.FullMethod, req)
 	resp, err := handler(ctx, req)
 	return resp, err
 }
 
+// VerifyDataInterceptor checks "hashsha256" metadata of MetricsExhange requests. Other services (OTLP)
+// are called by third-party clients which do not sign requests.
 func VerifyDataInterceptor(c servconfig.Config) grpc.UnaryServerInterceptor {
-	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		var hash string
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		var alg, signature string
 
-		if c.Key != "" {
+		if c.Key != "" && strings.HasPrefix(info.FullMethod, "/"+proto.MetricsExhange_ServiceDesc.ServiceName+"/") {
 			if md, ok := metadata.FromIncomingContext(ctx); ok {
-				values := md.Get("hashsha256")
-				if len(values) > 0 {
-					hash = values[0]
+				alg = firstValue(md, crypt.SignatureAlgKey)
+				if alg != "" {
+					signature = firstValue(md, crypt.SignatureKey)
+				} else {
+					signature = firstValue(md, "hashsha256")
 				}
 			}
 
-			reqStr := fmt.Sprint(req)
-			resultHash, _ := crypt.SignDataWithSHA256([]byte(reqStr), c.Key)
-
-			if !crypt.CheckHashSHA256(resultHash, hash) {
-				return nil, status.Error(codes.Internal, "signature is incorrect")
+			if err := checkSignature(c, req, alg, signature); err != nil {
+				return nil, err
 			}
 		}
 		return handler(ctx, req)
 	}
 }
 
+// firstValue returns the first metadata value of the key.
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// checkSignature checks signature of the message made with algorithm alg. Empty alg is the legacy HMAC of the
+// text output (fmt.Sprint), it is accepted until RejectLegacySign is set.
+func checkSignature(c servconfig.Config, msg interface{}, alg, signature string) error {
+	var resultHash string
+
+	switch alg {
+	case crypt.SignatureAlgSHA256PB:
+		pm, ok := msg.(protobuf.Message)
+		if !ok {
+			return status.Error(codes.Internal, "signature is incorrect")
+		}
+		resultHash, _ = crypt.SignProtoWithSHA256(pm, c.Key)
+	case "":
+		if c.RejectLegacySign {
+			return status.Errorf(codes.Unauthenticated, "legacy signature is rejected, use %q", crypt.SignatureAlgSHA256PB)
+		}
+		resultHash, _ = crypt.SignDataWithSHA256([]byte(fmt.Sprint(msg)), c.Key)
+	default:
+		return status.Errorf(codes.InvalidArgument, "unsupported signature algorithm %q", alg)
+	}
+
+	if !crypt.CheckHashSHA256(resultHash, signature) {
+		return status.Error(codes.Internal, "signature is incorrect")
+	}
+	return nil
+}
+
 func DecryptDataInterceptor(c servconfig.Config) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 
@@ -719,3 +1363,103 @@ func DecryptDataInterceptor(c servconfig.Config) grpc.UnaryServerInterceptor {
 		return handler(ctx, req)
 	}
 }
+
+func (s verifyStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if batch, ok := m.(*proto.StreamBatch); ok {
+		signature := batch.Signature
+		if batch.SignatureAlg == "" {
+			signature = batch.Hashsha256
+		}
+		return checkSignature(s.cfg, batch.SignedMessage(), batch.SignatureAlg, signature)
+	}
+	return nil
+}
+
+func (s decryptStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if batch, ok := m.(*proto.StreamBatch); ok && batch.Crypt != nil {
+		var err error
+		batch.Crypt.Plainbuff, err = crypt.DecryptPKCS1v15(s.privateKey, batch.Crypt.Cryptbuff)
+		if err != nil {
+			return status.Errorf(codes.Internal, "can not decrypt send data: %v", err)
+		}
+	}
+	return nil
+}
+
+// VerifyDataStreamInterceptor is VerifyDataInterceptor for streams, the hash is checked for every received message.
+func VerifyDataStreamInterceptor(c servconfig.Config) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if c.Key != "" && strings.HasPrefix(info.FullMethod, "/"+proto.MetricsExhange_ServiceDesc.ServiceName+"/") {
+			ss = verifyStream{ServerStream: ss, cfg: c}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// DecryptDataStreamInterceptor is DecryptDataInterceptor for streams, every received message is decrypted.
+func DecryptDataStreamInterceptor(c servconfig.Config) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if c.PrivateKey != nil {
+			ss = decryptStream{ServerStream: ss, privateKey: c.PrivateKey}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// IdempotencyInterceptor replays the saved response if a request with the same "idempotency-key" metadata was already processed.
+func IdempotencyInterceptor(c servconfig.Config, store idempotency.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		var key string
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			values := md.Get(idempotency.HeaderName)
+			if len(values) > 0 {
+				key = values[0]
+			}
+		}
+		if key == "" || c.IdempotencyWindow <= 0 {
+			return handler(ctx, req)
+		}
+		key = info.FullMethod + ":" + key
+
+		saved, err := store.Begin(ctx, key, c.IdempotencyWindow)
+		if errors.Is(err, idempotency.ErrInProgress) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "idempotency store error: %v", err)
+		}
+		if saved != nil {
+			var anyResp anypb.Any
+			if err := protobuf.Unmarshal(saved.Body, &anyResp); err != nil {
+				return nil, status.Errorf(codes.Internal, "can not unmarshal saved response: %v", err)
+			}
+			return anyResp.UnmarshalNew()
+		}
+
+		resp, err = handler(ctx, req)
+		if err != nil {
+			store.Release(ctx, key)
+			return resp, err
+		}
+
+		if msg, ok := resp.(protobuf.Message); ok {
+			anyResp, aErr := anypb.New(msg)
+			if aErr == nil {
+				body, aErr := protobuf.Marshal(anyResp)
+				if aErr == nil {
+					store.Complete(ctx, key, idempotency.Response{Status: http.StatusOK, ContentType: "application/grpc+proto", Body: body})
+					return resp, nil
+				}
+			}
+		}
+		store.Release(ctx, key)
+		return resp, nil
+	}
+}
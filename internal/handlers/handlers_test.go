@@ -8,22 +8,33 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang/snappy"
 	"github.com/impr0ver/metrics-service/internal/crypt"
 	"github.com/impr0ver/metrics-service/internal/handlers"
 	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/prompb"
 	"github.com/impr0ver/metrics-service/internal/servconfig"
 	"github.com/impr0ver/metrics-service/internal/storage"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -423,6 +434,372 @@ func TestMetricsHandlerPostBatch(t *testing.T) {
 	assert.Equal(t, string(respBody), "Registered successfully!")
 }
 
+func TestIdempotencyMiddleware(t *testing.T) {
+	testJSON := `[{ "id": "PollCount", "type": "counter", "delta": 5 },
+  { "id": "Alloc", "type": "gauge", "value": 308568 }]`
+
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+	cfg.IdempotencyWindow = time.Minute
+
+	r := handlers.ChiRouter(&memstorage, &cfg)
+
+	tests := []struct {
+		name     string
+		key      string
+		replayed string
+		want     int64
+	}{
+		{"first batch #1", "batch-1", "", 5},
+		{"repeated batch #2", "batch-1", "true", 5},
+		{"new batch #3", "batch-2", "", 10},
+		{"batch without key #4", "", "", 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(testJSON))
+			request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+			if tt.key != "" {
+				request.Header.Set("Idempotency-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			respBody, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+
+			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, "Registered successfully!", string(respBody))
+			assert.Equal(t, tt.replayed, res.Header.Get("Idempotent-Replayed"))
+
+			counter, err := memstorage.GetCounterByKey(context.TODO(), "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, int64(counter))
+		})
+	}
+}
+
+func TestMetricsHandlerInfluxWrite(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+
+	r := handlers.ChiRouter(&memstorage, &cfg)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		httpStatus int
+	}{
+		{"v2 write #1", "/api/v2/write?org=o&bucket=b&precision=s",
+			"cpu,host=srv1 value=0.5,user=12.5 1700000000\nrequests,host=srv1 count=3i 1700000000", http.StatusNoContent},
+		{"v1 write #2", "/write?db=metrics", "requests,host=srv1 count=2i", http.StatusNoContent},
+		{"bad line #3", "/write", "requests,host=srv1", http.StatusBadRequest},
+		{"bad precision #4", "/api/v2/write?precision=d", "cpu value=1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			res.Body.Close()
+			assert.Equal(t, tt.httpStatus, res.StatusCode)
+		})
+	}
+
+	gauge, err := memstorage.GetGaugeByKey(context.TODO(), `cpu{host="srv1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, float64(gauge))
+
+	gauge, err = memstorage.GetGaugeByKey(context.TODO(), `cpu_user{host="srv1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, float64(gauge))
+
+	counter, err := memstorage.GetCounterByKey(context.TODO(), `requests_count{host="srv1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), int64(counter))
+}
+
+func TestMetricsHandlerRemoteWrite(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+
+	r := handlers.ChiRouter(&memstorage, &cfg)
+
+	writeReq := &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}},
+			Samples: []*prompb.Sample{{Value: 10, Timestamp: 1000}, {Value: 12, Timestamp: 2000}}},
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []*prompb.Sample{{Value: 1, Timestamp: 2000}, {Value: math.NaN(), Timestamp: 3000}}},
+	}}
+	reqBytes, err := protobuf.Marshal(writeReq)
+	require.NoError(t, err)
+
+	noName, err := protobuf.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "job", Value: "api"}}, Samples: []*prompb.Sample{{Value: 1}}}}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       []byte
+		httpStatus int
+	}{
+		{"remote write #1", snappy.Encode(nil, reqBytes), http.StatusNoContent},
+		{"not snappy #2", reqBytes, http.StatusBadRequest},
+		{"no metric name #3", snappy.Encode(nil, noName), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/x-protobuf")
+			request.Header.Set("Content-Encoding", "snappy")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			res.Body.Close()
+			assert.Equal(t, tt.httpStatus, res.StatusCode)
+		})
+	}
+
+	gauge, err := memstorage.GetGaugeByKey(context.TODO(), `http_requests_total{job="api"}`)
+	require.NoError(t, err)
+	assert.Equal(t, 12.0, float64(gauge))
+
+	gauge, err = memstorage.GetGaugeByKey(context.TODO(), "up")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, float64(gauge))
+}
+
+func TestMetricsHandlerOTLP(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+
+	r := handlers.ChiRouter(&memstorage, &cfg)
+
+	exportReq := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{Name: "requests", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				IsMonotonic:            true,
+				DataPoints:             []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}}},
+			}}},
+			{Name: "temp", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5}}},
+			}}},
+		}}},
+	}}}
+	protoBody, err := protobuf.Marshal(exportReq)
+	require.NoError(t, err)
+	jsonBody, err := protojson.Marshal(exportReq)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		httpStatus  int
+	}{
+		{"otlp protobuf #1", "application/x-protobuf", protoBody, http.StatusOK},
+		{"otlp json #2", "application/json", jsonBody, http.StatusOK},
+		{"bad json #3", "application/json", []byte("{"), http.StatusBadRequest},
+		{"unsupported type #4", "text/plain", protoBody, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.httpStatus, res.StatusCode)
+			if tt.httpStatus == http.StatusOK {
+				assert.Equal(t, tt.contentType, res.Header.Get("Content-Type"))
+			}
+		})
+	}
+
+	counter, err := memstorage.GetCounterByKey(context.TODO(), "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), int64(counter))
+
+	gauge, err := memstorage.GetGaugeByKey(context.TODO(), "temp")
+	require.NoError(t, err)
+	assert.Equal(t, 21.5, float64(gauge))
+}
+
+func TestHealthProbes(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+
+	tests := []struct {
+		name       string
+		cfg        servconfig.Config
+		url        string
+		httpStatus int
+		body       string
+	}{
+		{"liveness #1", servconfig.Config{}, "/healthz", http.StatusOK, `{"status":"ok"}`},
+		{"ready without dependencies #2", servconfig.Config{}, "/readyz", http.StatusOK, `{"status":"ok","checks":{}}`},
+		{"file storage ready #3", servconfig.Config{StoreFile: t.TempDir() + "/metrics.json"}, "/readyz", http.StatusOK,
+			`{"status":"ok","checks":{"file":"ok"}}`},
+		{"db not ready #4", servconfig.Config{DatabaseDSN: "dsn"}, "/readyz", http.StatusServiceUnavailable,
+			`{"status":"unavailable","checks":{"storage":"method is not implemented"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.TrustedSubnet = "10.0.0.0/8" // probes are not checked
+			r := handlers.ChiRouter(&memstorage, &tt.cfg)
+
+			request := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.httpStatus, res.StatusCode)
+			assert.JSONEq(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestGateway(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+	var cfg servconfig.Config
+	cfg.TrustedSubnet = "0.0.0.0/0"
+	r := handlers.ChiRouter(&memstorage, &cfg)
+
+	// steps depend on each other: updates first, then reads
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		httpStatus int
+		want       string
+	}{
+		{"update gauge #1", http.MethodPost, "/api/v1/update", `{"id":"Alloc","mtype":"GAUGE","value":1.5}`, http.StatusOK,
+			`{"metric":{"id":"Alloc","mtype":"GAUGE","delta":"0","value":1.5}}`},
+		{"update counter #2", http.MethodPost, "/api/v1/update", `{"id":"PollCount","mtype":"COUNTER","delta":2}`, http.StatusOK,
+			`{"metric":{"id":"PollCount","mtype":"COUNTER","delta":"2","value":0}}`},
+		{"batch update #3", http.MethodPost, "/api/v1/updates", `{"metrics":[{"id":"PollCount","mtype":"COUNTER","delta":3},{"id":"Heap","mtype":"GAUGE","value":7}]}`,
+			http.StatusOK, `{"error":""}`},
+		{"value from path #4", http.MethodGet, "/api/v1/value/COUNTER/PollCount", "", http.StatusOK,
+			`{"id":"PollCount","mtype":"COUNTER","delta":"5","value":0}`},
+		{"value from body #5", http.MethodPost, "/api/v1/value", `{"id":"Heap","mtype":"GAUGE"}`, http.StatusOK,
+			`{"id":"Heap","mtype":"GAUGE","delta":"0","value":7}`},
+		{"value not found #6", http.MethodGet, "/api/v1/value/GAUGE/Unknown", "", http.StatusNotFound, ""},
+		{"get all with query #7", http.MethodGet, "/api/v1/metrics?mtype=GAUGE&page_size=1", "", http.StatusOK,
+			`{"metrics":[{"id":"Alloc","mtype":"GAUGE","delta":"0","value":1.5}],"next_page_token":"1"}`},
+		{"get many #8", http.MethodPost, "/api/v1/metrics/batch", `{"ids":["Heap"]}`, http.StatusOK,
+			`{"metrics":[{"id":"Heap","mtype":"GAUGE","delta":"0","value":7}]}`},
+		{"bad page size #9", http.MethodGet, "/api/v1/metrics?page_size=-1", "", http.StatusBadRequest, ""},
+		{"unknown route #10", http.MethodGet, "/api/v1/unknown", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.httpStatus, res.StatusCode)
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestGateway_cryptUpdates(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, crypt.GenKeys(dir))
+	pubKey, err := crypt.InitPublicKey(dir + "/public.pem")
+	require.NoError(t, err)
+	privKey, err := crypt.InitPrivateKey(dir + "/private.pem")
+	require.NoError(t, err)
+
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+	var cfg servconfig.Config
+	cfg.TrustedSubnet = "0.0.0.0/0"
+	cfg.PrivateKey = privKey
+	cfg.Key = "secretkey"
+	r := handlers.ChiRouter(&memstorage, &cfg)
+
+	metricsBytes, err := json.Marshal(&proto.MetricsArray{Metrics: []*proto.Metrics{{Id: "PollCount", Mtype: proto.Metrics_COUNTER, Delta: 4}}})
+	require.NoError(t, err)
+	cryptbuff, err := crypt.EncryptPKCS1v15(pubKey, metricsBytes)
+	require.NoError(t, err)
+	encrypted := &proto.CryptMetrics{Cryptbuff: cryptbuff}
+	signature, err := crypt.SignProtoWithSHA256(encrypted, cfg.Key)
+	require.NoError(t, err)
+	plain := &proto.CryptMetrics{Plainbuff: metricsBytes}
+	plainSignature, err := crypt.SignProtoWithSHA256(plain, cfg.Key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		msg        *proto.CryptMetrics
+		signature  string
+		httpStatus int
+		want       storage.Counter
+	}{
+		{"encrypted and signed #1", encrypted, signature, http.StatusOK, 4},
+		{"no signature #2", encrypted, "", http.StatusInternalServerError, 4},
+		{"plainbuff from the client #3", plain, plainSignature, http.StatusBadRequest, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := protojson.Marshal(tt.msg)
+			require.NoError(t, err)
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/crypt-updates", bytes.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			if tt.signature != "" {
+				request.Header.Set("Grpc-Metadata-"+crypt.SignatureAlgKey, crypt.SignatureAlgSHA256PB)
+				request.Header.Set("Grpc-Metadata-"+crypt.SignatureKey, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.httpStatus, res.StatusCode)
+
+			counter, _ := memstorage.GetCounterByKey(context.Background(), "PollCount")
+			assert.Equal(t, tt.want, counter)
+		})
+	}
+}
+
 func TestDataBasePing(t *testing.T) {
 	var memStor storage.MemoryStoragerInterface
 
@@ -716,13 +1093,16 @@ func grpcTestServer(c servconfig.Config, ms storage.MemoryStoragerInterface) (pr
 	buffer := 101024 * 1024
 	lis := bufconn.Listen(buffer)
 
+	idem := handlers.NewIdempotencyStore(ms)
 	// creates a gRPC server which has no service registered
 	baseServer := grpc.NewServer(grpc.ChainUnaryInterceptor(grpc.UnaryServerInterceptor(handlers.LoggingInterceptor),
 		grpc.UnaryServerInterceptor(handlers.VerifyDataInterceptor(c)),
-		grpc.UnaryServerInterceptor(handlers.DecryptDataInterceptor(c))))
+		grpc.UnaryServerInterceptor(handlers.DecryptDataInterceptor(c)),
+		grpc.UnaryServerInterceptor(handlers.IdempotencyInterceptor(c, idem))),
+		grpc.ChainStreamInterceptor(handlers.VerifyDataStreamInterceptor(c), handlers.DecryptDataStreamInterceptor(c)))
 
 	// service register
-	proto.RegisterMetricsExhangeServer(baseServer, handlers.RPC{Config: c, Ms: ms})
+	proto.RegisterMetricsExhangeServer(baseServer, handlers.RPC{Config: c, Ms: ms, Idem: idem})
 	//reflection.Register(baseServer)
 	go func() {
 		if err := baseServer.Serve(lis); err != nil {
@@ -1062,3 +1442,230 @@ func TestCryptUpdates(t *testing.T) {
 	os.Remove("./public.pem")
 	os.Remove("./private.pem")
 }
+
+func TestUpdates_idempotency(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+	cfg.IdempotencyWindow = time.Minute
+
+	client, closer := grpcTestServer(cfg, &memstorage)
+	defer closer()
+
+	metrics := proto.MetricsArray{Metrics: []*proto.Metrics{{Id: "PollCount", Mtype: proto.Metrics_COUNTER, Delta: 3}}}
+
+	tests := []struct {
+		name string
+		key  string
+		want int64
+	}{
+		{"first batch #1", "batch-1", 3},
+		{"repeated batch #2", "batch-1", 3},
+		{"new batch #3", "batch-2", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", tt.key)
+
+			res, err := client.Updates(ctx, &metrics)
+			require.NoError(t, err)
+			assert.Equal(t, "", res.Error)
+
+			counter, err := memstorage.GetCounterByKey(context.TODO(), "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, int64(counter))
+		})
+	}
+}
+
+func TestStreamUpdates(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+	cfg.Key = "secretkey"
+
+	client, closer := grpcTestServer(cfg, &memstorage)
+	defer closer()
+
+	stream, err := client.StreamUpdates(context.Background())
+	require.NoError(t, err)
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		batch := proto.StreamBatch{Seq: seq, Metrics: &proto.MetricsArray{Metrics: []*proto.Metrics{
+			{Id: "PollCount", Mtype: proto.Metrics_COUNTER, Delta: 2},
+			{Id: "Alloc", Mtype: proto.Metrics_GAUGE, Value: float64(seq)},
+		}}}
+		if seq%2 == 0 { // legacy signature is accepted
+			batch.Hashsha256, err = crypt.SignDataWithSHA256([]byte(fmt.Sprint(batch.SignedMessage())), cfg.Key)
+		} else {
+			batch.SignatureAlg = crypt.SignatureAlgSHA256PB
+			batch.Signature, err = crypt.SignProtoWithSHA256(batch.SignedMessage(), cfg.Key)
+		}
+		require.NoError(t, err)
+
+		require.NoError(t, stream.Send(&batch))
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, seq, ack.Seq)
+		assert.Empty(t, ack.Error)
+	}
+
+	counter, err := memstorage.GetCounterByKey(context.Background(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, storage.Counter(6), counter)
+	gauge, err := memstorage.GetGaugeByKey(context.Background(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, storage.Gauge(3), gauge)
+
+	// wrong signature closes the stream
+	require.NoError(t, stream.Send(&proto.StreamBatch{Seq: 4, Metrics: &proto.MetricsArray{}, Hashsha256: "bad"}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestStreamUpdates_idempotency(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+	cfg.IdempotencyWindow = time.Minute
+
+	client, closer := grpcTestServer(cfg, &memstorage)
+	defer closer()
+
+	stream, err := client.StreamUpdates(context.Background())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  string
+		want int64
+	}{
+		{"first batch #1", "batch-1", 3},
+		{"resent batch #2", "batch-1", 3},
+		{"new batch #3", "batch-2", 6},
+		{"batch without key #4", "", 9},
+		{"batch without key again #5", "", 12},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := proto.StreamBatch{Seq: uint64(i + 1), IdempotencyKey: tt.key, Metrics: &proto.MetricsArray{Metrics: []*proto.Metrics{
+				{Id: "PollCount", Mtype: proto.Metrics_COUNTER, Delta: 3},
+			}}}
+			require.NoError(t, stream.Send(&batch))
+			ack, err := stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, batch.Seq, ack.Seq)
+			assert.Empty(t, ack.Error)
+
+			counter, err := memstorage.GetCounterByKey(context.Background(), "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, int64(counter))
+		})
+	}
+}
+
+func TestGetAll(t *testing.T) {
+	memstorage := storage.MemoryStorage{
+		Gauges:   map[string]storage.Gauge{"Alloc": 1.5, "HeapSys": 2.5, "PollCount": 3.5},
+		Counters: map[string]storage.Counter{"PollCount": 7, "Requests": 9},
+	}
+	var cfg = servconfig.Config{}
+	cfg.TrustedSubnet = "0.0.0.0/0"
+
+	client, closer := grpcTestServer(cfg, &memstorage)
+	defer closer()
+
+	ids := func(metrics []*proto.Metrics) []string {
+		var res []string
+		for _, m := range metrics {
+			res = append(res, fmt.Sprintf("%s/%s", m.Id, m.Mtype))
+		}
+		return res
+	}
+
+	tests := []struct {
+		name      string
+		req       *proto.GetAllRequest
+		want      []string
+		nextToken string
+		code      codes.Code
+	}{
+		{"all metrics #1", &proto.GetAllRequest{},
+			[]string{"Alloc/GAUGE", "HeapSys/GAUGE", "PollCount/GAUGE", "PollCount/COUNTER", "Requests/COUNTER"}, "", codes.OK},
+		{"counters #2", &proto.GetAllRequest{Mtype: proto.Metrics_COUNTER},
+			[]string{"PollCount/COUNTER", "Requests/COUNTER"}, "", codes.OK},
+		{"prefix #3", &proto.GetAllRequest{Prefix: "P"},
+			[]string{"PollCount/GAUGE", "PollCount/COUNTER"}, "", codes.OK},
+		{"first page #4", &proto.GetAllRequest{PageSize: 2},
+			[]string{"Alloc/GAUGE", "HeapSys/GAUGE"}, "2", codes.OK},
+		{"last page #5", &proto.GetAllRequest{PageSize: 2, PageToken: "4"},
+			[]string{"Requests/COUNTER"}, "", codes.OK},
+		{"bad page token #6", &proto.GetAllRequest{PageToken: "x"}, nil, "", codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.GetAll(context.Background(), tt.req)
+			assert.Equal(t, tt.code, status.Code(err))
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tt.want, ids(res.Metrics))
+			assert.Equal(t, tt.nextToken, res.NextPageToken)
+		})
+	}
+
+	res, err := client.GetMany(context.Background(), &proto.GetManyRequest{Ids: []string{"PollCount", "Alloc", "Unknown"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc/GAUGE", "PollCount/GAUGE", "PollCount/COUNTER"}, ids(res.Metrics))
+	assert.Equal(t, int64(7), res.Metrics[2].Delta)
+}
+
+func TestVerifyDataInterceptor(t *testing.T) {
+	memstorage := storage.MemoryStorage{Gauges: make(map[string]storage.Gauge),
+		Counters: make(map[string]storage.Counter)}
+
+	metrics := &proto.MetricsArray{Metrics: []*proto.Metrics{{Id: "Alloc", Mtype: proto.Metrics_GAUGE, Value: 1}}}
+	signature, err := crypt.SignProtoWithSHA256(metrics, "secretkey")
+	require.NoError(t, err)
+	legacy, err := crypt.SignDataWithSHA256([]byte(metrics.String()), "secretkey")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		rejectLegacy bool
+		md           []string
+		code         codes.Code
+	}{
+		{"signature #1", false, []string{crypt.SignatureAlgKey, crypt.SignatureAlgSHA256PB, crypt.SignatureKey, signature}, codes.OK},
+		{"wrong signature #2", false, []string{crypt.SignatureAlgKey, crypt.SignatureAlgSHA256PB, crypt.SignatureKey, legacy}, codes.Internal},
+		{"legacy hash #3", false, []string{"hashsha256", legacy}, codes.OK},
+		{"legacy hash rejected #4", true, []string{"hashsha256", legacy}, codes.Unauthenticated},
+		{"signature with legacy rejected #5", true, []string{crypt.SignatureAlgKey, crypt.SignatureAlgSHA256PB, crypt.SignatureKey, signature}, codes.OK},
+		{"unsupported algorithm #6", false, []string{crypt.SignatureAlgKey, "md5", crypt.SignatureKey, signature}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg = servconfig.Config{}
+			cfg.TrustedSubnet = "0.0.0.0/0"
+			cfg.Key = "secretkey"
+			cfg.RejectLegacySign = tt.rejectLegacy
+
+			client, closer := grpcTestServer(cfg, &memstorage)
+			defer closer()
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.md...)
+			_, err := client.Updates(ctx, metrics)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
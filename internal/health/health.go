@@ -0,0 +1,119 @@
+// Health package checks server dependencies and implements grpc.health.v1 Health service.
+// Every dependency is a service of the Health service: "storage" (database reachable via DBPing)
+// and "file" (directory of the store file is writable). The empty service name is the overall status:
+// serving only if all dependencies are serving.
+package health
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/impr0ver/metrics-service/internal/servconfig"
+	"github.com/impr0ver/metrics-service/internal/storage"
+)
+
+// Check checks one dependency, nil means the dependency is serving.
+type Check func(ctx context.Context) error
+
+// Checker runs dependency checks.
+type Checker struct {
+	healthpb.UnimplementedHealthServer
+	checks map[string]Check
+}
+
+const (
+	StorageService = "storage"
+	FileService    = "file"
+)
+
+// watchInterval how often Watch checks the status.
+var watchInterval = 5 * time.Second
+
+// NewChecker returns Checker with dependencies of the config: database or store file.
+func NewChecker(cfg *servconfig.Config, ms storage.MemoryStoragerInterface) *Checker {
+	c := &Checker{checks: make(map[string]Check)}
+	if cfg.DatabaseDSN != "" {
+		c.checks[StorageService] = ms.DBPing
+	} else if cfg.StoreFile != "" {
+		c.checks[FileService] = func(context.Context) error { return DirWritable(filepath.Dir(cfg.StoreFile)) }
+	}
+	return c
+}
+
+// DirWritable checks that a file can be created in the directory.
+func DirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".health-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// CheckAll runs all checks and returns errors by dependency name, nil error means serving.
+func (c *Checker) CheckAll(ctx context.Context) map[string]error {
+	res := make(map[string]error, len(c.checks))
+	for name, check := range c.checks {
+		res[name] = check(ctx)
+	}
+	return res
+}
+
+// status returns status of the service, the empty service is the overall status.
+func (c *Checker) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	var errs map[string]error
+	if service == "" {
+		errs = c.CheckAll(ctx)
+	} else {
+		check, ok := c.checks[service]
+		if !ok {
+			return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service %q", service)
+		}
+		errs = map[string]error{service: check(ctx)}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return healthpb.HealthCheckResponse_NOT_SERVING, nil
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING, nil
+}
+
+// Check implements grpc.health.v1 Health Check.
+func (c *Checker) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, err := c.status(ctx, req.Service)
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch implements grpc.health.v1 Health Watch, the status is sent on every change.
+func (c *Checker) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		st, _ := c.status(stream.Context(), req.Service)
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package health_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/impr0ver/metrics-service/internal/health"
+	"github.com/impr0ver/metrics-service/internal/servconfig"
+	"github.com/impr0ver/metrics-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Check(t *testing.T) {
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		cfg     servconfig.Config
+		service string
+		want    healthpb.HealthCheckResponse_ServingStatus
+		code    codes.Code
+	}{
+		{"no dependencies #1", servconfig.Config{}, "", healthpb.HealthCheckResponse_SERVING, codes.OK},
+		{"file writable #2", servconfig.Config{StoreFile: filepath.Join(dir, "metrics.json")}, health.FileService,
+			healthpb.HealthCheckResponse_SERVING, codes.OK},
+		{"file not writable #3", servconfig.Config{StoreFile: filepath.Join(dir, "no", "metrics.json")}, "",
+			healthpb.HealthCheckResponse_NOT_SERVING, codes.OK},
+		{"storage unreachable #4", servconfig.Config{DatabaseDSN: "dsn"}, health.StorageService,
+			healthpb.HealthCheckResponse_NOT_SERVING, codes.OK},
+		{"unknown service #5", servconfig.Config{}, health.StorageService, 0, codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := health.NewChecker(&tt.cfg, ms)
+			res, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{Service: tt.service})
+			require.Equal(t, tt.code, status.Code(err))
+			if err == nil {
+				assert.Equal(t, tt.want, res.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Idempotency package remembers responses of already processed requests by their idempotency key.
+// A client that retries a request with the same key gets the original response back instead of a second update.
+package idempotency
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// HeaderName HTTP header (and gRPC metadata key in lower case) with the idempotency key.
+const HeaderName = "Idempotency-Key"
+
+// ErrInProgress is returned by Begin when a request with the same key is being processed right now.
+var ErrInProgress = errors.New("request with the same idempotency key is in progress")
+
+type (
+	// Response saved result of the first request.
+	Response struct {
+		Status      int    `json:"status"`
+		ContentType string `json:"content_type"`
+		Body        []byte `json:"body"`
+	}
+
+	// Store keeps idempotency keys with their responses.
+	Store interface {
+		// Begin reserves key for window. If the key is already completed, the saved response is returned.
+		Begin(ctx context.Context, key string, window time.Duration) (*Response, error)
+		// Complete saves the response for the reserved key.
+		Complete(ctx context.Context, key string, resp Response) error
+		// Release drops the reservation, so the request can be repeated.
+		Release(ctx context.Context, key string) error
+	}
+
+	entry struct {
+		resp    *Response
+		expires time.Time
+	}
+
+	// expiry key with its expiration time, expiries are kept in a min-heap by time.
+	expiry struct {
+		key     string
+		expires time.Time
+	}
+
+	expiryHeap []expiry
+
+	// MemoryStore - Store organized in RAM.
+	MemoryStore struct {
+		sync.Mutex
+		entries  map[string]entry
+		expiries expiryHeap
+	}
+)
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// NewMemoryStore return empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]entry)}
+}
+
+// Begin reserves key (storage in memory). Expired keys are removed from the head of the expiry heap,
+// so a call does not scan all keys.
+func (s *MemoryStore) Begin(ctx context.Context, key string, window time.Duration) (*Response, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	s.expire(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.resp == nil {
+			return nil, ErrInProgress
+		}
+		return e.resp, nil
+	}
+	e := entry{expires: now.Add(window)}
+	s.entries[key] = e
+	heap.Push(&s.expiries, expiry{key: key, expires: e.expires})
+	return nil, nil
+}
+
+// expire removes keys expired by now. A heap item of a key which was released and reserved again
+// does not remove the new reservation.
+func (s *MemoryStore) expire(now time.Time) {
+	for len(s.expiries) > 0 && !now.Before(s.expiries[0].expires) {
+		x := heap.Pop(&s.expiries).(expiry)
+		if e, ok := s.entries[x.key]; ok && !now.Before(e.expires) {
+			delete(s.entries, x.key)
+		}
+	}
+}
+
+// Complete saves response for key (storage in memory).
+func (s *MemoryStore) Complete(ctx context.Context, key string, resp Response) error {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	e.resp = &resp
+	s.entries[key] = e
+	return nil
+}
+
+// Release removes key (storage in memory).
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
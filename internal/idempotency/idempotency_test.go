@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	saved, err := store.Begin(ctx, "key1", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, saved, "test #first request")
+
+	_, err = store.Begin(ctx, "key1", time.Minute)
+	assert.ErrorIs(t, err, ErrInProgress, "test #request in progress")
+
+	resp := Response{Status: 200, ContentType: "text/plain", Body: []byte("Registered successfully!")}
+	require.NoError(t, store.Complete(ctx, "key1", resp))
+
+	saved, err = store.Begin(ctx, "key1", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, saved, "test #replay")
+	assert.Equal(t, resp, *saved)
+
+	// released key can be used again
+	_, err = store.Begin(ctx, "key2", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, store.Release(ctx, "key2"))
+	saved, err = store.Begin(ctx, "key2", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, saved, "test #after release")
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	_, err := store.Begin(ctx, "key", time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, "key", Response{Status: 200}))
+
+	time.Sleep(5 * time.Millisecond)
+
+	saved, err := store.Begin(ctx, "key", time.Millisecond)
+	require.NoError(t, err)
+	assert.Nil(t, saved, "test #expired key")
+}
+
+func TestMemoryStoreExpireHeap(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := store.Begin(ctx, key, time.Millisecond)
+		require.NoError(t, err)
+	}
+	// "b" is released and reserved again for a long window, its old heap item must not remove it
+	require.NoError(t, store.Release(ctx, "b"))
+	_, err := store.Begin(ctx, "b", time.Minute)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = store.Begin(ctx, "d", time.Minute)
+	require.NoError(t, err)
+
+	store.Lock()
+	assert.Len(t, store.entries, 2, "test #expired keys are removed")
+	assert.Len(t, store.expiries, 2, "test #expired heap items are removed")
+	store.Unlock()
+
+	_, err = store.Begin(ctx, "b", time.Minute)
+	assert.ErrorIs(t, err, ErrInProgress, "test #new reservation is kept")
+}
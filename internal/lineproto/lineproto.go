@@ -0,0 +1,218 @@
+// Lineproto package parses InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Integer fields end with "i", unsigned with "u", strings are in double quotes, booleans are t/f/true/false.
+package lineproto
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// FieldType type of the field value.
+	FieldType int
+
+	// Field one field value of the point.
+	Field struct {
+		Type  FieldType
+		Int   int64
+		Uint  uint64
+		Float float64
+		Str   string
+		Bool  bool
+	}
+
+	// Point one line of line protocol.
+	Point struct {
+		Measurement string
+		Tags        map[string]string
+		Fields      map[string]Field
+		Time        time.Time // zero if the line has no timestamp
+	}
+)
+
+const (
+	Float FieldType = iota
+	Integer
+	Unsigned
+	String
+	Boolean
+)
+
+// Precisions maps precision parameter (v1 and v2 API) to the timestamp unit.
+var Precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"n":  time.Nanosecond,
+	"us": time.Microsecond,
+	"u":  time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// Parse reads all lines from r. Empty lines and comments (#) are skipped.
+func Parse(r io.Reader, precision string) ([]Point, error) {
+	unit, ok := Precisions[precision]
+	if !ok {
+		return nil, fmt.Errorf("unknown precision %q", precision)
+	}
+
+	var points []Point
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p, err := ParseLine(line, unit)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		points = append(points, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// ParseLine parses one line, unit is the timestamp unit.
+func ParseLine(line string, unit time.Duration) (Point, error) {
+	p := Point{Tags: make(map[string]string), Fields: make(map[string]Field)}
+
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return p, errors.New("expected measurement, fields and optional timestamp")
+	}
+
+	// measurement and tags
+	keys := split(sections[0], ',', false)
+	p.Measurement = unescape(keys[0])
+	if p.Measurement == "" {
+		return p, errors.New("empty measurement")
+	}
+	for _, kv := range keys[1:] {
+		k, v, err := splitPair(kv)
+		if err != nil {
+			return p, fmt.Errorf("tag %q: %w", kv, err)
+		}
+		p.Tags[k] = unescape(v)
+	}
+
+	// fields
+	for _, kv := range split(sections[1], ',', true) {
+		k, v, err := splitPair(kv)
+		if err != nil {
+			return p, fmt.Errorf("field %q: %w", kv, err)
+		}
+		f, err := parseFieldValue(v)
+		if err != nil {
+			return p, fmt.Errorf("field %q: %w", k, err)
+		}
+		p.Fields[k] = f
+	}
+
+	// timestamp
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("bad timestamp: %w", err)
+		}
+		p.Time = time.Unix(0, ts*int64(unit))
+	}
+	return p, nil
+}
+
+// split divides s by unescaped sep. If quotes is true, sep inside double quotes is ignored.
+func split(s string, sep byte, quotes bool) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quotes:
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitPair divides "key=value" by the first unescaped "=".
+func splitPair(kv string) (string, string, error) {
+	for i := 0; i < len(kv); i++ {
+		switch kv[i] {
+		case '\\':
+			i++
+		case '=':
+			k := unescape(kv[:i])
+			if k == "" {
+				return "", "", errors.New("empty key")
+			}
+			if i+1 == len(kv) {
+				return "", "", errors.New("empty value")
+			}
+			return k, kv[i+1:], nil
+		}
+	}
+	return "", "", errors.New("missing \"=\"")
+}
+
+// unescape removes backslashes before escaped characters.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parseFieldValue(v string) (Field, error) {
+	switch {
+	case v[0] == '"':
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return Field{}, errors.New("unterminated string")
+		}
+		return Field{Type: String, Str: unescape(v[1 : len(v)-1])}, nil
+	case strings.HasSuffix(v, "i"):
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return Field{Type: Integer, Int: n}, err
+	case strings.HasSuffix(v, "u"):
+		n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return Field{Type: Unsigned, Uint: n}, err
+	}
+
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return Field{Type: Boolean, Bool: true}, nil
+	case "f", "F", "false", "False", "FALSE":
+		return Field{Type: Boolean, Bool: false}, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	return Field{Type: Float, Float: f}, err
+}
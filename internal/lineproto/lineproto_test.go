@@ -0,0 +1,79 @@
+package lineproto
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Point
+	}{
+		{"simple float #1", "cpu value=0.5",
+			Point{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]Field{"value": {Type: Float, Float: 0.5}}}},
+		{"tags and fields #2", "disk,host=srv1,path=/var used=10i,free=20u,ok=t 1700000000",
+			Point{Measurement: "disk", Tags: map[string]string{"host": "srv1", "path": "/var"},
+				Fields: map[string]Field{"used": {Type: Integer, Int: 10}, "free": {Type: Unsigned, Uint: 20}, "ok": {Type: Boolean, Bool: true}},
+				Time:   time.Unix(1700000000, 0)}},
+		{"escaped chars #3", `my\ measure,tag\,key=va\=lue msg="hello, \"world\"",n=-1.5e3`,
+			Point{Measurement: "my measure", Tags: map[string]string{"tag,key": "va=lue"},
+				Fields: map[string]Field{"msg": {Type: String, Str: `hello, "world"`}, "n": {Type: Float, Float: -1500}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseLine(tt.line, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Measurement, p.Measurement)
+			assert.Equal(t, tt.want.Tags, p.Tags)
+			assert.Equal(t, tt.want.Fields, p.Fields)
+			assert.True(t, tt.want.Time.Equal(p.Time), "test #timestamp")
+		})
+	}
+}
+
+func TestParseLine_negative(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"no fields #1", "cpu"},
+		{"bad field #2", "cpu value"},
+		{"bad integer #3", "cpu value=1.5i"},
+		{"bad timestamp #4", "cpu value=1 abc"},
+		{"unterminated string #5", `cpu value="abc`},
+		{"empty measurement #6", ",host=a value=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLine(tt.line, time.Nanosecond)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	body := `# comment
+cpu,host=a value=1 1700000000000
+
+mem,host=a used=5i 1700000000000
+`
+	points, err := Parse(strings.NewReader(body), "ms")
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, "mem", points[1].Measurement)
+	assert.True(t, time.UnixMilli(1700000000000).Equal(points[1].Time))
+
+	_, err = Parse(strings.NewReader(body), "days")
+	assert.Error(t, err, "test #unknown precision")
+
+	_, err = Parse(strings.NewReader("cpu value=1\ncpu"), "")
+	assert.ErrorContains(t, err, "line 2")
+}
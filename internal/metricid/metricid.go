@@ -0,0 +1,83 @@
+// Metricid package contains the encoding of metric labels into the metric ID: name{k1="v1",k2="v2"}.
+// It is shared by the agent and the server, so both of them make and parse IDs the same way.
+package metricid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// labelEscaper escapes label values in Format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Format returns metric name with labels in the form: name{k1="v1",k2="v2"}.
+// Labels are sorted by key, so the same set of labels always gives the same ID.
+func Format(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Parse returns name and labels of the ID made by Format, ID without labels is the name.
+func Parse(id string) (string, map[string]string, error) {
+	labels := make(map[string]string)
+	open := strings.IndexByte(id, '{')
+	if open < 0 {
+		return id, labels, nil
+	}
+	name, s := id[:open], id[open+1:]
+
+	for {
+		if s == "}" {
+			return name, labels, nil
+		}
+		eq := strings.Index(s, `="`)
+		if eq <= 0 {
+			return "", nil, fmt.Errorf("bad labels of metric %q", id)
+		}
+		key := s[:eq]
+		s = s[eq+2:]
+
+		var value strings.Builder
+		i := 0
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", nil, fmt.Errorf("bad labels of metric %q", id)
+		}
+		labels[key] = value.String()
+
+		s = s[i+1:]
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if s != "}" {
+			return "", nil, fmt.Errorf("bad labels of metric %q", id)
+		}
+	}
+}
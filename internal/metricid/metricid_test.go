@@ -0,0 +1,57 @@
+package metricid_test
+
+import (
+	"testing"
+
+	"github.com/impr0ver/metrics-service/internal/metricid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric string
+		labels map[string]string
+		want   string
+	}{
+		{"no labels #1", "cpu", nil, "cpu"},
+		{"sorted labels #2", "cpu", map[string]string{"host": "a", "core": "1"}, `cpu{core="1",host="a"}`},
+		{"escaped value #3", "log", map[string]string{"msg": `say "hi" \o/`}, `log{msg="say \"hi\" \\o/"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, metricid.Format(tt.metric, tt.labels))
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		wantName   string
+		wantLabels map[string]string
+		wantErr    bool
+	}{
+		{"no labels #1", "cpu", "cpu", map[string]string{}, false},
+		{"labels #2", `cpu{core="1",host="a"}`, "cpu", map[string]string{"host": "a", "core": "1"}, false},
+		{"escaped value #3", `log{msg="say \"hi\", \\o/"}`, "log", map[string]string{"msg": `say "hi", \o/`}, false},
+		{"unterminated #4", `cpu{core="1"`, "", nil, true},
+		{"no quotes #5", `cpu{core=1}`, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, labels, err := metricid.Parse(tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantLabels, labels)
+			assert.Equal(t, tt.id, metricid.Format(name, labels), "test #round trip")
+		})
+	}
+}
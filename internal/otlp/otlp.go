@@ -0,0 +1,312 @@
+// Otlp package implements OpenTelemetry (OTLP) metrics receiver.
+// Metrics are mapped on the storage as follows:
+//
+//   - Gauge and non-monotonic Sum are gauges;
+//   - monotonic Sum is counter;
+//   - Histogram is counter "name_count", gauge "name_sum" and counters "name_bucket{le="..."}" with cumulative bucket counts
+//     (Prometheus style, the last bucket is le="+Inf");
+//   - ExponentialHistogram is counter "name_count" and gauge "name_sum";
+//   - Summary is gauges "name{quantile="..."}", counter "name_count" and gauge "name_sum".
+//
+// Resource attributes and data point attributes are metric labels, see metricid.Format.
+// The storage keeps the running total for both delta and cumulative aggregation temporality: cumulative counters
+// are converted to deltas by the last value of the series kept by the receiver (see Cumulative), deltas of
+// non-monotonic sums are added to the stored gauge.
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/impr0ver/metrics-service/internal/metricid"
+	"github.com/impr0ver/metrics-service/internal/storage"
+)
+
+// cumulativeTTL how long the last value of a cumulative series is kept without new points.
+const cumulativeTTL = time.Hour
+
+type (
+	// MetricsService gRPC OTLP metrics service.
+	MetricsService struct {
+		colmetricspb.UnimplementedMetricsServiceServer
+		Ms         storage.MemoryStoragerInterface
+		Cumulative *Cumulative
+	}
+
+	// Cumulative keeps the last value of every cumulative counter series (its ID has resource and data point
+	// attributes) to convert the next value to delta. The first point of the series is counted in full if the series
+	// started after the receiver, otherwise it is only the base: the counts before it may be stored already.
+	// A value less than the last one or a new start time is a reset of the source, the value is counted in full.
+	Cumulative struct {
+		mu        sync.Mutex
+		started   time.Time
+		lastPrune time.Time
+		last      map[string]cumulativePoint
+	}
+
+	cumulativePoint struct {
+		start uint64 // start time of the series, unix nanoseconds
+		value float64
+		seen  time.Time
+	}
+
+	// converter collects values of one export request before writing them in the storage.
+	converter struct {
+		gauges             map[string]float64
+		gaugeDeltas        map[string]float64
+		counterDeltas      map[string]float64
+		cumulativeCounters map[string]cumulativePoint
+	}
+)
+
+// NewCumulative returns empty Cumulative, series which started before it are counted from their next point.
+func NewCumulative() *Cumulative {
+	now := time.Now()
+	return &Cumulative{started: now, lastPrune: now, last: make(map[string]cumulativePoint)}
+}
+
+// Export stores metrics of the request.
+func (s MetricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	if err := Store(ctx, s.Ms, s.Cumulative, req); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+// Store converts metrics of the request and writes them in the storage as one batch.
+func Store(ctx context.Context, ms storage.MemoryStoragerInterface, cum *Cumulative, req *colmetricspb.ExportMetricsServiceRequest) error {
+	c := converter{
+		gauges:             make(map[string]float64),
+		gaugeDeltas:        make(map[string]float64),
+		counterDeltas:      make(map[string]float64),
+		cumulativeCounters: make(map[string]cumulativePoint),
+	}
+
+	for _, rm := range req.ResourceMetrics {
+		resourceLabels := attributesToLabels(nil, rm.GetResource().GetAttributes())
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				c.addMetric(m, resourceLabels)
+			}
+		}
+	}
+
+	metrics := c.metrics(ctx, ms, cum)
+	if len(metrics) == 0 {
+		return nil
+	}
+	return ms.AddNewMetricsAsBatch(ctx, metrics)
+}
+
+// addMetric puts data points of one metric into converter.
+func (c *converter) addMetric(m *metricspb.Metric, resourceLabels map[string]string) {
+	name := m.Name
+
+	switch data := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.DataPoints {
+			c.addSum(metricid.Format(name, attributesToLabels(resourceLabels, dp.Attributes)), numberValue(dp), false)
+		}
+
+	case *metricspb.Metric_Sum:
+		delta := data.Sum.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.Sum.DataPoints {
+			id := metricid.Format(name, attributesToLabels(resourceLabels, dp.Attributes))
+			if data.Sum.IsMonotonic {
+				c.addCounter(id, numberValue(dp), delta, dp.StartTimeUnixNano)
+			} else {
+				c.addSum(id, numberValue(dp), delta)
+			}
+		}
+
+	case *metricspb.Metric_Histogram:
+		delta := data.Histogram.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.Histogram.DataPoints {
+			labels := attributesToLabels(resourceLabels, dp.Attributes)
+			c.addCounter(metricid.Format(name+"_count", labels), float64(dp.Count), delta, dp.StartTimeUnixNano)
+			c.addSum(metricid.Format(name+"_sum", labels), dp.GetSum(), delta)
+
+			var cumulative uint64
+			for i, count := range dp.BucketCounts {
+				cumulative += count
+				le := "+Inf"
+				if i < len(dp.ExplicitBounds) {
+					le = strconv.FormatFloat(dp.ExplicitBounds[i], 'g', -1, 64)
+				}
+				c.addCounter(metricid.Format(name+"_bucket", withLabel(labels, "le", le)), float64(cumulative), delta, dp.StartTimeUnixNano)
+			}
+		}
+
+	case *metricspb.Metric_ExponentialHistogram:
+		delta := data.ExponentialHistogram.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.ExponentialHistogram.DataPoints {
+			labels := attributesToLabels(resourceLabels, dp.Attributes)
+			c.addCounter(metricid.Format(name+"_count", labels), float64(dp.Count), delta, dp.StartTimeUnixNano)
+			c.addSum(metricid.Format(name+"_sum", labels), dp.GetSum(), delta)
+		}
+
+	case *metricspb.Metric_Summary:
+		// summary is always cumulative
+		for _, dp := range data.Summary.DataPoints {
+			labels := attributesToLabels(resourceLabels, dp.Attributes)
+			c.addCounter(metricid.Format(name+"_count", labels), float64(dp.Count), false, dp.StartTimeUnixNano)
+			c.gauges[metricid.Format(name+"_sum", labels)] = dp.Sum
+			for _, q := range dp.QuantileValues {
+				quantile := strconv.FormatFloat(q.Quantile, 'g', -1, 64)
+				c.gauges[metricid.Format(name, withLabel(labels, "quantile", quantile))] = q.Value
+			}
+		}
+	}
+}
+
+// addCounter puts counter value, delta is false for cumulative value of the series started at start.
+func (c *converter) addCounter(id string, value float64, delta bool, start uint64) {
+	if math.IsNaN(value) {
+		return
+	}
+	if delta {
+		c.counterDeltas[id] += value
+	} else {
+		c.cumulativeCounters[id] = cumulativePoint{start: start, value: value}
+	}
+}
+
+// addSum puts gauge keeping the running total, delta is false for cumulative value.
+func (c *converter) addSum(id string, value float64, delta bool) {
+	if math.IsNaN(value) {
+		return
+	}
+	if delta {
+		c.gaugeDeltas[id] += value
+	} else {
+		c.gauges[id] = value
+	}
+}
+
+// metrics returns collected values as storage metrics, cumulative counters are converted to deltas by cum.
+func (c *converter) metrics(ctx context.Context, ms storage.MemoryStoragerInterface, cum *Cumulative) []storage.Metrics {
+	metrics := make([]storage.Metrics, 0, len(c.gauges)+len(c.gaugeDeltas)+len(c.counterDeltas)+len(c.cumulativeCounters))
+	addCounter := func(id string, v float64) {
+		delta := int64(math.Round(v))
+		metrics = append(metrics, storage.Metrics{ID: id, MType: "counter", Delta: &delta})
+	}
+	addGauge := func(id string, v float64) {
+		metrics = append(metrics, storage.Metrics{ID: id, MType: "gauge", Value: &v})
+	}
+
+	for id, v := range c.gauges {
+		addGauge(id, v)
+	}
+	for id, v := range c.gaugeDeltas {
+		if _, ok := c.gauges[id]; ok {
+			continue // cumulative value of the same series wins
+		}
+		current, err := ms.GetGaugeByKey(ctx, id)
+		if err == nil {
+			v += float64(current)
+		}
+		addGauge(id, v)
+	}
+	for id, v := range c.counterDeltas {
+		addCounter(id, v)
+	}
+
+	cum.mu.Lock()
+	defer cum.mu.Unlock()
+	now := time.Now()
+	cum.prune(now)
+	for id, p := range c.cumulativeCounters {
+		if _, ok := c.counterDeltas[id]; ok {
+			continue // delta value of the same series wins
+		}
+		p.seen = now
+		addCounter(id, cum.delta(id, p))
+	}
+	return metrics
+}
+
+// delta returns increase of the series since its last point and keeps the point. Cum must be locked.
+func (cum *Cumulative) delta(id string, p cumulativePoint) float64 {
+	last, ok := cum.last[id]
+	cum.last[id] = p
+	switch {
+	case !ok:
+		if p.start != 0 && p.start >= uint64(cum.started.UnixNano()) {
+			return p.value // the whole series is received
+		}
+		return 0
+	case p.start != last.start || p.value < last.value:
+		return p.value // reset of the source
+	}
+	return p.value - last.value
+}
+
+// prune removes series without points for cumulativeTTL, at most once per cumulativeTTL. Cum must be locked.
+func (cum *Cumulative) prune(now time.Time) {
+	if now.Sub(cum.lastPrune) < cumulativeTTL {
+		return
+	}
+	cum.lastPrune = now
+	for id, p := range cum.last {
+		if now.Sub(p.seen) >= cumulativeTTL {
+			delete(cum.last, id)
+		}
+	}
+}
+
+// numberValue returns value of the data point as float64.
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	switch v := dp.Value.(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	}
+	return math.NaN()
+}
+
+// attributesToLabels returns copy of base labels with attributes added.
+func attributesToLabels(base map[string]string, attrs []*commonpb.KeyValue) map[string]string {
+	labels := make(map[string]string, len(base)+len(attrs))
+	for k, v := range base {
+		labels[k] = v
+	}
+	for _, kv := range attrs {
+		labels[kv.Key] = anyValueString(kv.Value)
+	}
+	return labels
+}
+
+// withLabel returns copy of labels with one more label.
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	return attributesToLabels(labels, []*commonpb.KeyValue{{Key: name, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}})
+}
+
+// anyValueString returns attribute value as label value.
+func anyValueString(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return fmt.Sprintf("%x", v.BytesValue)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
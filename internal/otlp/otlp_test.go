@@ -0,0 +1,185 @@
+package otlp_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/impr0ver/metrics-service/internal/otlp"
+	"github.com/impr0ver/metrics-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func attr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func request(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{attr("host", "a")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+// later start time of series which start after the receiver.
+func later() uint64 {
+	return uint64(time.Now().Add(time.Minute).UnixNano())
+}
+
+func sum(name string, temporality metricspb.AggregationTemporality, monotonic bool, start uint64, v int64) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		AggregationTemporality: temporality,
+		IsMonotonic:            monotonic,
+		DataPoints:             []*metricspb.NumberDataPoint{{StartTimeUnixNano: start, Value: &metricspb.NumberDataPoint_AsInt{AsInt: v}}},
+	}}}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	histSum := 7.5
+	start := later()
+
+	tests := []struct {
+		name     string
+		requests []*colmetricspb.ExportMetricsServiceRequest
+		counters map[string]storage.Counter
+		gauges   map[string]storage.Gauge
+	}{
+		{
+			name: "gauge with attributes",
+			requests: []*colmetricspb.ExportMetricsServiceRequest{request(&metricspb.Metric{Name: "temp", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{{Attributes: []*commonpb.KeyValue{attr("room", "1")}, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5}}},
+			}}})},
+			counters: map[string]storage.Counter{},
+			gauges:   map[string]storage.Gauge{`temp{host="a",room="1"}`: 21.5},
+		},
+		{
+			name: "cumulative monotonic sum",
+			requests: []*colmetricspb.ExportMetricsServiceRequest{
+				request(sum("requests", cumulative, true, start, 5)),
+				request(sum("requests", cumulative, true, start, 8)),
+			},
+			counters: map[string]storage.Counter{`requests{host="a"}`: 8},
+			gauges:   map[string]storage.Gauge{},
+		},
+		{
+			name: "delta monotonic sum",
+			requests: []*colmetricspb.ExportMetricsServiceRequest{
+				request(sum("requests", delta, true, 0, 5)),
+				request(sum("requests", delta, true, 0, 8)),
+			},
+			counters: map[string]storage.Counter{`requests{host="a"}`: 13},
+			gauges:   map[string]storage.Gauge{},
+		},
+		{
+			name: "non-monotonic sum",
+			requests: []*colmetricspb.ExportMetricsServiceRequest{
+				request(sum("queue", delta, false, 0, 5)),
+				request(sum("queue", delta, false, 0, -2)),
+			},
+			counters: map[string]storage.Counter{},
+			gauges:   map[string]storage.Gauge{`queue{host="a"}`: 3},
+		},
+		{
+			name: "histogram",
+			requests: []*colmetricspb.ExportMetricsServiceRequest{request(&metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				AggregationTemporality: cumulative,
+				DataPoints: []*metricspb.HistogramDataPoint{{
+					StartTimeUnixNano: start,
+					Count:             4,
+					Sum:               &histSum,
+					ExplicitBounds:    []float64{1, 2.5},
+					BucketCounts:      []uint64{1, 2, 1},
+				}},
+			}}})},
+			counters: map[string]storage.Counter{
+				`latency_count{host="a"}`:            4,
+				`latency_bucket{host="a",le="1"}`:    1,
+				`latency_bucket{host="a",le="2.5"}`:  3,
+				`latency_bucket{host="a",le="+Inf"}`: 4,
+			},
+			gauges: map[string]storage.Gauge{`latency_sum{host="a"}`: 7.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+			cum := otlp.NewCumulative()
+			for _, req := range tt.requests {
+				require.NoError(t, otlp.Store(ctx, ms, cum, req))
+			}
+
+			counters, err := ms.GetAllCounters(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.counters, counters)
+
+			gauges, err := ms.GetAllGauges(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.gauges, gauges)
+		})
+	}
+}
+
+func TestMetricsService_Export(t *testing.T) {
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+	s := otlp.MetricsService{Ms: ms, Cumulative: otlp.NewCumulative()}
+
+	resp, err := s.Export(context.Background(), request(sum("requests", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, true, 0, 2)))
+	require.NoError(t, err)
+	assert.NotNil(t, resp)
+
+	v, err := ms.GetCounterByKey(context.Background(), `requests{host="a"}`)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Counter(2), v)
+}
+
+func TestStore_cumulative(t *testing.T) {
+	ctx := context.Background()
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+	cum := otlp.NewCumulative()
+	counter := func(id string) storage.Counter {
+		v, _ := ms.GetCounterByKey(ctx, id)
+		return v
+	}
+	export := func(name string, start uint64, v int64) {
+		assert.NoError(t, otlp.Store(ctx, ms, cum, request(sum(name, cumulative, true, start, v))))
+	}
+
+	// series started before the receiver: its counts before the first point are unknown
+	earlier := uint64(time.Now().Add(-time.Hour).UnixNano())
+	export("old", earlier, 100)
+	export("old", earlier, 105)
+	assert.Equal(t, storage.Counter(5), counter(`old{host="a"}`), "test #first point is the base")
+
+	start := later()
+	export("new", start, 3)
+	assert.Equal(t, storage.Counter(3), counter(`new{host="a"}`), "test #new series is counted in full")
+	export("new", start, 1)
+	assert.Equal(t, storage.Counter(4), counter(`new{host="a"}`), "test #less value is reset")
+	export("new", start+1, 2)
+	assert.Equal(t, storage.Counter(6), counter(`new{host="a"}`), "test #new start time is reset")
+
+	// concurrent exports of the same value add it once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			export("new", start+1, 12)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, storage.Counter(16), counter(`new{host="a"}`), "test #concurrent exports")
+}
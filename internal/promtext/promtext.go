@@ -0,0 +1,179 @@
+// Promtext package parses Prometheus text exposition format and OpenMetrics text format:
+//
+//	# TYPE name type
+//	name[{label="value",...}] value [timestamp] [# exemplar]
+//
+// Label values may contain escaped \\, \" and \n. HELP, UNIT and other comments, timestamps and exemplars are skipped.
+package promtext
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MetricType type of the metric family from the TYPE comment.
+type MetricType string
+
+const (
+	Counter        MetricType = "counter"
+	Gauge          MetricType = "gauge"
+	Histogram      MetricType = "histogram"
+	GaugeHistogram MetricType = "gaugehistogram"
+	Summary        MetricType = "summary"
+	Info           MetricType = "info"
+	StateSet       MetricType = "stateset"
+	Untyped        MetricType = "untyped" // "unknown" in OpenMetrics, or no TYPE comment
+)
+
+// Sample one sample line.
+type Sample struct {
+	Name   string // sample name, e.g. "requests_total" or "latency_bucket"
+	Family string // metric family name from the TYPE comment, Name if there is no TYPE comment
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+}
+
+// familySuffixes suffixes of sample names of counter, histogram, summary and info families.
+var familySuffixes = []string{"_total", "_created", "_bucket", "_count", "_sum", "_gcount", "_gsum", "_info"}
+
+// Parse reads all samples from r.
+func Parse(r io.Reader) ([]Sample, error) {
+	types := make(map[string]MetricType)
+	var samples []Sample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = parseType(fields[3])
+			}
+			continue
+		}
+
+		s, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		s.Family, s.Type = family(s.Name, types)
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// ParseLine parses one sample line, Family and Type are not set.
+func ParseLine(line string) (Sample, error) {
+	s := Sample{Labels: make(map[string]string)}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, errors.New("no value")
+	}
+	s.Name = line[:end]
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		var err error
+		if rest, err = parseLabels(rest[1:], s.Labels); err != nil {
+			return s, err
+		}
+	}
+
+	// value [timestamp] [# exemplar]
+	if i := strings.Index(rest, "#"); i >= 0 {
+		rest = rest[:i]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("want value and optional timestamp, got %q", rest)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, err
+	}
+	s.Value = v
+	return s, nil
+}
+
+// parseLabels parses labels after "{" into labels and returns the rest of the line after "}".
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return "", errors.New("unterminated labels")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return "", errors.New("bad label")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return "", fmt.Errorf("value of label %q is not quoted", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", fmt.Errorf("unterminated value of label %q", name)
+		}
+		labels[name] = value.String()
+		s = s[i+1:]
+	}
+}
+
+// family returns family name and type of the sample name.
+func family(name string, types map[string]MetricType) (string, MetricType) {
+	if t, ok := types[name]; ok {
+		return name, t
+	}
+	for _, suffix := range familySuffixes {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			if t, ok := types[base]; ok {
+				return base, t
+			}
+		}
+	}
+	return name, Untyped
+}
+
+func parseType(s string) MetricType {
+	switch t := MetricType(strings.ToLower(s)); t {
+	case Counter, Gauge, Histogram, GaugeHistogram, Summary, Info, StateSet:
+		return t
+	}
+	return Untyped
+}
@@ -0,0 +1,88 @@
+package promtext
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{"no labels #1", "up 1", Sample{Name: "up", Labels: map[string]string{}, Value: 1}, false},
+		{"labels and timestamp #2", `http_requests_total{method="post",code="200"} 1027 1395066363000`,
+			Sample{Name: "http_requests_total", Labels: map[string]string{"method": "post", "code": "200"}, Value: 1027}, false},
+		{"escaped label value #3", `msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9`,
+			Sample{Name: "msdos_file_access_time_seconds", Labels: map[string]string{"path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\""},
+				Value: 1.458255915e9}, false},
+		{"braces and hash in label value #4", `rpc{path="/a{b}#c",} +Inf`,
+			Sample{Name: "rpc", Labels: map[string]string{"path": "/a{b}#c"}, Value: math.Inf(1)}, false},
+		{"exemplar #5", `latency_bucket{le="0.5"} 129 # {trace_id="abc"} 0.3 1520879607.789`,
+			Sample{Name: "latency_bucket", Labels: map[string]string{"le": "0.5"}, Value: 129}, false},
+		{"no value #6", `up`, Sample{}, true},
+		{"unquoted label #7", `up{job=api} 1`, Sample{}, true},
+		{"unterminated labels #8", `up{job="api" 1`, Sample{}, true},
+		{"bad value #9", `up one`, Sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseLine(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	text := `# HELP requests Requests.
+# TYPE requests counter
+requests_total{code="200"} 10
+requests_created{code="200"} 1.7e9
+# TYPE temperature gauge
+temperature 21.5
+# TYPE latency histogram
+latency_bucket{le="1"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 2.5
+latency_count 3
+go_goroutines 8
+# EOF
+`
+	samples, err := Parse(strings.NewReader(text))
+	require.NoError(t, err)
+
+	type got struct {
+		name, family string
+		typ          MetricType
+		value        float64
+	}
+	res := make([]got, 0, len(samples))
+	for _, s := range samples {
+		res = append(res, got{s.Name, s.Family, s.Type, s.Value})
+	}
+	assert.Equal(t, []got{
+		{"requests_total", "requests", Counter, 10},
+		{"requests_created", "requests", Counter, 1.7e9},
+		{"temperature", "temperature", Gauge, 21.5},
+		{"latency_bucket", "latency", Histogram, 2},
+		{"latency_bucket", "latency", Histogram, 3},
+		{"latency_sum", "latency", Histogram, 2.5},
+		{"latency_count", "latency", Histogram, 3},
+		{"go_goroutines", "go_goroutines", Untyped, 8},
+	}, res)
+
+	_, err = Parse(strings.NewReader("ok 1\nbad{ 1\n"))
+	assert.EqualError(t, err, "line 2: bad label")
+}
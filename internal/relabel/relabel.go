@@ -0,0 +1,214 @@
+// Relabel package changes names and labels of the agent metrics before sending by the rules of agconfig "relabel".
+// Rules are applied in order to the name and labels of every metric (see metricid.Format), actions are:
+//
+//   - keep: the metric is dropped if Regex does not match its name;
+//   - drop: the metric is dropped if Regex matches its name;
+//   - rename: the name matching Regex is replaced by Replacement, Labels are added to the metric;
+//   - label: Labels are added to metrics matching Regex (all metrics if Regex is empty);
+//   - prefix: Prefix is added to names matching Regex (all metrics if Regex is empty).
+//
+// Regex matches the whole name. Replacement and label values may refer to groups of Regex as $1 or ${name},
+// a label with empty value is removed. "${HOSTNAME}" in Replacement, label values and Prefix is the host name.
+//
+// Example, CPUutilization1 becomes CPUutilization{cpu="1"}:
+//
+//	{"action": "rename", "regex": "CPUutilization(\\d+)", "replacement": "CPUutilization", "labels": {"cpu": "$1"}}
+//
+// Metrics which get the same ID are merged (see Rules.Apply), the agent relabels the whole report
+// before it is split into batches, so every ID is sent once per report.
+package relabel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+)
+
+// Actions of rules.
+const (
+	Keep   = "keep"
+	Drop   = "drop"
+	Rename = "rename"
+	Label  = "label"
+	Prefix = "prefix"
+)
+
+// hostnameVar placeholder of the host name.
+const hostnameVar = "${HOSTNAME}"
+
+type (
+	// Rules compiled relabel rules, nil Rules do not change metrics.
+	Rules struct {
+		rules []rule
+	}
+
+	rule struct {
+		action      string
+		re          *regexp.Regexp // nil - all names
+		replacement string
+		labels      map[string]string
+		prefix      string
+	}
+)
+
+// New compiles rules, nil if there are no rules.
+func New(rules []agconfig.RelabelRule) (*Rules, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Rules{}
+	for i, cfg := range rules {
+		rl, err := newRule(cfg, hostname)
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule #%d: %w", i+1, err)
+		}
+		r.rules = append(r.rules, rl)
+	}
+	return r, nil
+}
+
+func newRule(cfg agconfig.RelabelRule, hostname string) (rule, error) {
+	rl := rule{
+		action:      cfg.Action,
+		replacement: strings.ReplaceAll(cfg.Replacement, hostnameVar, hostname),
+		prefix:      strings.ReplaceAll(cfg.Prefix, hostnameVar, hostname),
+		labels:      make(map[string]string, len(cfg.Labels)),
+	}
+	for k, v := range cfg.Labels {
+		if k == "" {
+			return rule{}, errors.New("empty label name")
+		}
+		rl.labels[k] = strings.ReplaceAll(v, hostnameVar, hostname)
+	}
+
+	if cfg.Regex != "" {
+		re, err := regexp.Compile("^(?:" + cfg.Regex + ")$")
+		if err != nil {
+			return rule{}, err
+		}
+		rl.re = re
+	}
+
+	switch cfg.Action {
+	case Keep, Drop:
+		if rl.re == nil {
+			return rule{}, fmt.Errorf("regex is required for %q", cfg.Action)
+		}
+	case Rename:
+		if rl.re == nil || rl.replacement == "" {
+			return rule{}, fmt.Errorf("regex and replacement are required for %q", cfg.Action)
+		}
+	case Label:
+		if len(rl.labels) == 0 {
+			return rule{}, fmt.Errorf("labels are required for %q", cfg.Action)
+		}
+	case Prefix:
+		if rl.prefix == "" {
+			return rule{}, fmt.Errorf("prefix is required for %q", cfg.Action)
+		}
+	default:
+		return rule{}, fmt.Errorf("unknown action %q", cfg.Action)
+	}
+	return rl, nil
+}
+
+// Apply returns relabeled metrics, metrics are not changed. Counters which get the same ID are summed,
+// of gauges with the same ID the last one is kept. Sources maps IDs of the relabeled counters to the ID of one
+// of their source counters: counts which are not sent are returned there and relabeled again with the next report.
+func (r *Rules) Apply(metrics []agmemory.Metrics) ([]agmemory.Metrics, map[string]string) {
+	if r == nil {
+		return metrics, nil
+	}
+
+	res := make([]agmemory.Metrics, 0, len(metrics))
+	index := make(map[string]int) // by type and ID
+	sources := make(map[string]string)
+	for _, m := range metrics {
+		id, ok := r.relabel(m.ID)
+		if !ok {
+			continue
+		}
+		if m.Delta != nil {
+			sources[id] = m.ID
+		}
+		m.ID = id
+
+		key := m.MType + " " + id
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(res)
+			res = append(res, m)
+			continue
+		}
+		if m.Delta != nil && res[i].Delta != nil {
+			sum := *res[i].Delta + *m.Delta
+			m.Delta = &sum
+		}
+		res[i] = m
+	}
+	return res, sources
+}
+
+// relabel returns new ID of the metric, false if the metric is dropped.
+func (r *Rules) relabel(id string) (string, bool) {
+	name, labels, err := metricid.Parse(id)
+	if err != nil { // not made by metricid.Format, the whole ID is the name
+		name, labels = id, make(map[string]string)
+	}
+
+	for _, rl := range r.rules {
+		var match []int
+		if rl.re != nil {
+			match = rl.re.FindStringSubmatchIndex(name)
+		}
+		matched := rl.re == nil || match != nil
+
+		switch rl.action {
+		case Keep:
+			if !matched {
+				return "", false
+			}
+			continue
+		case Drop:
+			if matched {
+				return "", false
+			}
+			continue
+		}
+		if !matched {
+			continue
+		}
+
+		expand := func(template string) string {
+			if match == nil {
+				return template
+			}
+			return string(rl.re.ExpandString(nil, template, name, match))
+		}
+		for k, v := range rl.labels {
+			if v = expand(v); v != "" {
+				labels[k] = v
+			} else {
+				delete(labels, k)
+			}
+		}
+		switch rl.action {
+		case Rename:
+			name = expand(rl.replacement)
+		case Prefix:
+			name = rl.prefix + name
+		}
+	}
+	return metricid.Format(name, labels), true
+}
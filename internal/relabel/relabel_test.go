@@ -0,0 +1,140 @@
+package relabel
+
+import (
+	"os"
+	"testing"
+
+	"github.com/impr0ver/metrics-service/internal/agconfig"
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryMetrics returns contents of the agent memory as they are sent.
+func memoryMetrics(am agmemory.AgMemory) []agmemory.Metrics {
+	var metrics []agmemory.Metrics
+	for k, v := range am.RuntimeMetrics {
+		val := float64(v)
+		metrics = append(metrics, agmemory.Metrics{ID: k, MType: "gauge", Value: &val})
+	}
+	for k, v := range am.PollCount {
+		delta := int64(v)
+		metrics = append(metrics, agmemory.Metrics{ID: k, MType: "counter", Delta: &delta})
+	}
+	return metrics
+}
+
+// values returns gauges and counters of metrics by ID.
+func values(metrics []agmemory.Metrics) (map[string]float64, map[string]int64) {
+	gauges, counters := make(map[string]float64), make(map[string]int64)
+	for _, m := range metrics {
+		if m.Value != nil {
+			gauges[m.ID] = *m.Value
+		}
+		if m.Delta != nil {
+			counters[m.ID] = *m.Delta
+		}
+	}
+	return gauges, counters
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		rule agconfig.RelabelRule
+	}{
+		{"unknown action #1", agconfig.RelabelRule{Action: "replace", Regex: "a"}},
+		{"keep without regex #2", agconfig.RelabelRule{Action: Keep}},
+		{"rename without replacement #3", agconfig.RelabelRule{Action: Rename, Regex: "a"}},
+		{"label without labels #4", agconfig.RelabelRule{Action: Label}},
+		{"prefix without prefix #5", agconfig.RelabelRule{Action: Prefix}},
+		{"bad regex #6", agconfig.RelabelRule{Action: Drop, Regex: "("}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]agconfig.RelabelRule{tt.rule})
+			assert.Error(t, err)
+		})
+	}
+
+	r, err := New(nil)
+	require.NoError(t, err)
+	assert.Nil(t, r, "test #no rules")
+}
+
+func TestApply(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	am := agmemory.NewAgMemory()
+	am.RuntimeMetrics["CPUutilization1"] = 10
+	am.RuntimeMetrics["CPUutilization2"] = 20
+	am.RuntimeMetrics["CPUutilization1.max"] = 90
+	am.RuntimeMetrics["Alloc"] = 100
+	am.RuntimeMetrics["Lookups"] = 0
+	am.RuntimeMetrics["RandomValue"] = 0.5
+	am.RuntimeMetrics[`DiskUsed{mountpoint="/"}`] = 50
+	am.PollCount["PollCount"] = 2
+	am.PollCount["Requests"] = 3
+	am.PollCount["HTTPRequests"] = 4
+
+	tests := []struct {
+		name         string
+		rules        []agconfig.RelabelRule
+		wantGauges   map[string]float64
+		wantCounters map[string]int64
+	}{
+		{"no rules #1", nil,
+			map[string]float64{"CPUutilization1": 10, "CPUutilization2": 20, "CPUutilization1.max": 90, "Alloc": 100,
+				"Lookups": 0, "RandomValue": 0.5, `DiskUsed{mountpoint="/"}`: 50},
+			map[string]int64{"PollCount": 2, "Requests": 3, "HTTPRequests": 4}},
+		{"keep and drop #2", []agconfig.RelabelRule{
+			{Action: Keep, Regex: "CPU.*|Disk.*|PollCount"},
+			{Action: Drop, Regex: `.*\.max`},
+		},
+			map[string]float64{"CPUutilization1": 10, "CPUutilization2": 20, `DiskUsed{mountpoint="/"}`: 50},
+			map[string]int64{"PollCount": 2}},
+		{"cpu label #3", []agconfig.RelabelRule{
+			{Action: Rename, Regex: `CPUutilization(\d+)(\..+)?`, Replacement: "CPUutilization$2", Labels: map[string]string{"cpu": "$1"}},
+			{Action: Keep, Regex: "CPUutilization.*"},
+		},
+			map[string]float64{`CPUutilization{cpu="1"}`: 10, `CPUutilization{cpu="2"}`: 20, `CPUutilization.max{cpu="1"}`: 90},
+			map[string]int64{}},
+		{"host label and prefix #4", []agconfig.RelabelRule{
+			{Action: Keep, Regex: "Alloc|DiskUsed"},
+			{Action: Label, Labels: map[string]string{"host": "${HOSTNAME}", "mountpoint": ""}},
+			{Action: Prefix, Regex: "Alloc", Prefix: "go_"},
+		},
+			map[string]float64{`go_Alloc{host="` + hostname + `"}`: 100, `DiskUsed{host="` + hostname + `"}`: 50},
+			map[string]int64{}},
+		{"renamed counters are summed #5", []agconfig.RelabelRule{
+			{Action: Rename, Regex: "(HTTP)?Requests", Replacement: "requests_total"},
+			{Action: Keep, Regex: "requests_total"},
+		},
+			map[string]float64{},
+			map[string]int64{"requests_total": 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.rules)
+			require.NoError(t, err)
+
+			metrics := memoryMetrics(am)
+			relabeled, _ := r.Apply(metrics)
+			gauges, counters := values(relabeled)
+			assert.Equal(t, tt.wantGauges, gauges)
+			assert.Equal(t, tt.wantCounters, counters)
+
+			// source metrics are not changed
+			srcGauges, srcCounters := values(metrics)
+			assert.Equal(t, int64(3), srcCounters["Requests"])
+			assert.Equal(t, float64(10), srcGauges["CPUutilization1"])
+		})
+	}
+
+	r, err := New(tests[4].rules)
+	require.NoError(t, err)
+	_, sources := r.Apply(memoryMetrics(am))
+	assert.Contains(t, []string{"Requests", "HTTPRequests"}, sources["requests_total"], "test #source of merged counter")
+}
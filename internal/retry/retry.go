@@ -0,0 +1,274 @@
+// Retry package implements retries of requests of the agent: exponential backoff with jitter,
+// classification of HTTP statuses and gRPC codes, "Retry-After" of the server and a circuit breaker
+// which stops requests to the server after several failures in a row.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen returned without request while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type (
+	// Policy of retries. Attempt n waits for a random time between d/2 and d, where d is InitialBackoff*2^(n-1)
+	// limited by MaxBackoff. MaxAttempts less than 2 means no retries.
+	Policy struct {
+		MaxAttempts    int
+		InitialBackoff time.Duration
+		MaxBackoff     time.Duration
+	}
+
+	// Retrier retries requests by the Policy, Breaker is optional. Nil Retrier makes one attempt.
+	Retrier struct {
+		Policy  Policy
+		Breaker *Breaker
+	}
+
+	// Breaker opens after Threshold failed requests in a row and rejects requests for Cooldown,
+	// then one request is let through: its success closes the breaker, its failure opens it again.
+	// Threshold less than 1 disables the breaker.
+	Breaker struct {
+		mu        sync.Mutex
+		threshold int
+		cooldown  time.Duration
+		failures  int
+		openUntil time.Time
+		probing   bool
+	}
+
+	permanentError struct {
+		err error
+	}
+
+	retryAfterError struct {
+		err   error
+		after time.Duration
+	}
+)
+
+// NewBreaker returns closed circuit breaker.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Do calls fn until it succeeds, returns a permanent error or the attempts are over.
+func (r *Retrier) Do(ctx context.Context, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if berr := r.Breaker.allow(); berr != nil {
+			if err != nil {
+				return fmt.Errorf("%w, last error: %v", berr, err)
+			}
+			return berr
+		}
+
+		err = fn()
+		if err == nil || IsPermanent(err) {
+			r.Breaker.success() // the server is available
+			return err
+		}
+		r.Breaker.failure()
+
+		if attempt >= r.Policy.MaxAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		wait := r.Policy.Backoff(attempt)
+		if after := RetryAfter(err); after > wait {
+			if r.Policy.MaxBackoff > 0 && after > r.Policy.MaxBackoff {
+				return fmt.Errorf("server asks to retry after %s: %w", after, err)
+			}
+			wait = after
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the wait before the next attempt after the failed attempt.
+func (p Policy) Backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// allow returns ErrCircuitOpen if the request is not allowed.
+func (b *Breaker) allow() error {
+	if b == nil || b.threshold < 1 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *Breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.probing = 0, false
+}
+
+func (b *Breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.probing || b.failures == b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	b.probing = false
+}
+
+// Permanent marks error which is not retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports if the error is marked by Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// After marks error which is retried not earlier than after d.
+func After(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, after: d}
+}
+
+// RetryAfter returns the wait set by After, 0 if it is not set.
+func RetryAfter(err error) time.Duration {
+	var r *retryAfterError
+	if errors.As(err, &r) {
+		return r.after
+	}
+	return 0
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// HTTPStatus returns error of the response status: nil for 1xx-3xx, retryable error for 408, 425, 429
+// and 5xx except 501 and 505 (with "Retry-After" of the response), permanent error for others.
+func HTTPStatus(res *http.Response) error {
+	if res.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+	err := fmt.Errorf("server response: %s", res.Status)
+
+	switch res.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return Permanent(err)
+	default:
+		if res.StatusCode < http.StatusInternalServerError {
+			return Permanent(err)
+		}
+	}
+
+	if d := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); d > 0 {
+		return After(err, d)
+	}
+	return err
+}
+
+// parseRetryAfter parses "Retry-After" in seconds or HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// GRPCError returns permanent error for gRPC codes which are not retried. DeadlineExceeded, ResourceExhausted,
+// Aborted, Unavailable and errors without gRPC status (broken stream) are retried. Canceled is not retried:
+// it is the result of the caller's own cancel.
+func GRPCError(err error) error {
+	if err == nil || IsPermanent(err) {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Unavailable:
+		return err
+	}
+	return Permanent(err)
+}
@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{4, 400 * time.Millisecond, 800 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			d := p.Backoff(tt.attempt)
+			assert.True(t, d >= tt.min && d <= tt.max, "attempt %d: %s", tt.attempt, d)
+		}
+	}
+	assert.Equal(t, time.Duration(0), Policy{}.Backoff(3), "test #no backoff")
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	r := &Retrier{Policy: Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}}
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success #1", []error{nil}, 1, false},
+		{"retry then success #2", []error{errDown, errDown, nil}, 3, false},
+		{"attempts are over #3", []error{errDown, errDown, errDown, nil}, 3, true},
+		{"permanent #4", []error{Permanent(errDown), nil}, 1, true},
+		{"retry after above max backoff #5", []error{After(errDown, time.Minute), nil}, 1, true},
+		{"retry after #6", []error{After(errDown, 5*time.Millisecond), nil}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := r.Do(ctx, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errDown)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	var nilRetrier *Retrier
+	assert.ErrorIs(t, nilRetrier.Do(ctx, func() error { return errDown }), errDown, "test #nil retrier")
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	r := &Retrier{Policy: Policy{MaxAttempts: 1}, Breaker: NewBreaker(2, 50*time.Millisecond)}
+	errDown := errors.New("down")
+	calls := 0
+	fail := func() error { calls++; return errDown }
+	ok := func() error { calls++; return nil }
+
+	assert.ErrorIs(t, r.Do(ctx, fail), errDown)
+	assert.ErrorIs(t, r.Do(ctx, fail), errDown)
+	assert.ErrorIs(t, r.Do(ctx, ok), ErrCircuitOpen, "test #open after threshold")
+	assert.Equal(t, 2, calls, "test #no request while open")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.ErrorIs(t, r.Do(ctx, fail), errDown, "test #probe after cooldown")
+	assert.ErrorIs(t, r.Do(ctx, ok), ErrCircuitOpen, "test #open again after failed probe")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, r.Do(ctx, ok), "test #successful probe")
+	assert.NoError(t, r.Do(ctx, ok), "test #closed")
+	assert.Equal(t, 5, calls)
+
+	// permanent errors mean the server is available
+	r.Breaker = NewBreaker(1, time.Hour)
+	assert.True(t, IsPermanent(r.Do(ctx, func() error { return Permanent(errDown) })))
+	assert.NoError(t, r.Do(ctx, ok), "test #closed after permanent error")
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code          int
+		retryAfter    string
+		wantErr       bool
+		wantPermanent bool
+		wantAfter     time.Duration
+	}{
+		{http.StatusOK, "", false, false, 0},
+		{http.StatusBadRequest, "", true, true, 0},
+		{http.StatusTooManyRequests, "3", true, false, 3 * time.Second},
+		{http.StatusServiceUnavailable, "", true, false, 0},
+		{http.StatusBadGateway, "bad", true, false, 0},
+		{http.StatusNotImplemented, "", true, true, 0},
+	}
+	for _, tt := range tests {
+		res := &http.Response{StatusCode: tt.code, Status: http.StatusText(tt.code), Header: http.Header{}}
+		if tt.retryAfter != "" {
+			res.Header.Set("Retry-After", tt.retryAfter)
+		}
+		err := HTTPStatus(res)
+		assert.Equal(t, tt.wantErr, err != nil, tt.code)
+		assert.Equal(t, tt.wantPermanent, IsPermanent(err), tt.code)
+		assert.Equal(t, tt.wantAfter, RetryAfter(err), tt.code)
+	}
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Wed, 01 May 2024 10:01:30 GMT", now), "test #HTTP date")
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 01 May 2024 09:00:00 GMT", now), "test #past date")
+}
+
+func TestGRPCError(t *testing.T) {
+	assert.NoError(t, GRPCError(nil))
+	assert.False(t, IsPermanent(GRPCError(status.Error(codes.Unavailable, "down"))), "test #Unavailable")
+	assert.False(t, IsPermanent(GRPCError(errors.New("stream is broken"))), "test #no status")
+	assert.True(t, IsPermanent(GRPCError(status.Error(codes.InvalidArgument, "bad"))), "test #InvalidArgument")
+	assert.True(t, IsPermanent(GRPCError(status.Error(codes.Canceled, "canceled"))), "test #Canceled")
+	assert.True(t, IsPermanent(GRPCError(Permanent(errors.New("rejected")))), "test #already permanent")
+}
@@ -2,9 +2,7 @@
 // versions:
 // - protoc-gen-go-grpc v1.3.0
 // - protoc             v5.26.1
-// source: internal/rpc/rpc.proto
-
-//import "google/protobuf/empty.proto";
+// source: rpc.proto
 
 package proto
 
@@ -21,10 +19,13 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	MetricsExhange_Update_FullMethodName       = "/rpc.MetricsExhange/Update"
-	MetricsExhange_Updates_FullMethodName      = "/rpc.MetricsExhange/Updates"
-	MetricsExhange_GetValue_FullMethodName     = "/rpc.MetricsExhange/GetValue"
-	MetricsExhange_CryptUpdates_FullMethodName = "/rpc.MetricsExhange/CryptUpdates"
+	MetricsExhange_Update_FullMethodName        = "/rpc.MetricsExhange/Update"
+	MetricsExhange_Updates_FullMethodName       = "/rpc.MetricsExhange/Updates"
+	MetricsExhange_GetValue_FullMethodName      = "/rpc.MetricsExhange/GetValue"
+	MetricsExhange_CryptUpdates_FullMethodName  = "/rpc.MetricsExhange/CryptUpdates"
+	MetricsExhange_StreamUpdates_FullMethodName = "/rpc.MetricsExhange/StreamUpdates"
+	MetricsExhange_GetAll_FullMethodName        = "/rpc.MetricsExhange/GetAll"
+	MetricsExhange_GetMany_FullMethodName       = "/rpc.MetricsExhange/GetMany"
 )
 
 // MetricsExhangeClient is the client API for MetricsExhange service.
@@ -35,6 +36,10 @@ type MetricsExhangeClient interface {
 	Updates(ctx context.Context, in *MetricsArray, opts ...grpc.CallOption) (*MetricsUpdatesResponse, error)
 	GetValue(ctx context.Context, in *Metrics, opts ...grpc.CallOption) (*Metrics, error)
 	CryptUpdates(ctx context.Context, in *CryptMetrics, opts ...grpc.CallOption) (*MetricsUpdatesResponse, error)
+	// StreamUpdates is gRPC only, over HTTP batches are sent with Updates.
+	StreamUpdates(ctx context.Context, opts ...grpc.CallOption) (MetricsExhange_StreamUpdatesClient, error)
+	GetAll(ctx context.Context, in *GetAllRequest, opts ...grpc.CallOption) (*GetAllResponse, error)
+	GetMany(ctx context.Context, in *GetManyRequest, opts ...grpc.CallOption) (*MetricsArray, error)
 }
 
 type metricsExhangeClient struct {
@@ -81,6 +86,55 @@ func (c *metricsExhangeClient) CryptUpdates(ctx context.Context, in *CryptMetric
 	return out, nil
 }
 
+func (c *metricsExhangeClient) StreamUpdates(ctx context.Context, opts ...grpc.CallOption) (MetricsExhange_StreamUpdatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MetricsExhange_ServiceDesc.Streams[0], MetricsExhange_StreamUpdates_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsExhangeStreamUpdatesClient{stream}
+	return x, nil
+}
+
+type MetricsExhange_StreamUpdatesClient interface {
+	Send(*StreamBatch) error
+	Recv() (*StreamAck, error)
+	grpc.ClientStream
+}
+
+type metricsExhangeStreamUpdatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsExhangeStreamUpdatesClient) Send(m *StreamBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricsExhangeStreamUpdatesClient) Recv() (*StreamAck, error) {
+	m := new(StreamAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricsExhangeClient) GetAll(ctx context.Context, in *GetAllRequest, opts ...grpc.CallOption) (*GetAllResponse, error) {
+	out := new(GetAllResponse)
+	err := c.cc.Invoke(ctx, MetricsExhange_GetAll_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsExhangeClient) GetMany(ctx context.Context, in *GetManyRequest, opts ...grpc.CallOption) (*MetricsArray, error) {
+	out := new(MetricsArray)
+	err := c.cc.Invoke(ctx, MetricsExhange_GetMany_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsExhangeServer is the server API for MetricsExhange service.
 // All implementations must embed UnimplementedMetricsExhangeServer
 // for forward compatibility
@@ -89,6 +143,10 @@ type MetricsExhangeServer interface {
 	Updates(context.Context, *MetricsArray) (*MetricsUpdatesResponse, error)
 	GetValue(context.Context, *Metrics) (*Metrics, error)
 	CryptUpdates(context.Context, *CryptMetrics) (*MetricsUpdatesResponse, error)
+	// StreamUpdates is gRPC only, over HTTP batches are sent with Updates.
+	StreamUpdates(MetricsExhange_StreamUpdatesServer) error
+	GetAll(context.Context, *GetAllRequest) (*GetAllResponse, error)
+	GetMany(context.Context, *GetManyRequest) (*MetricsArray, error)
 	mustEmbedUnimplementedMetricsExhangeServer()
 }
 
@@ -108,6 +166,15 @@ func (UnimplementedMetricsExhangeServer) GetValue(context.Context, *Metrics) (*M
 func (UnimplementedMetricsExhangeServer) CryptUpdates(context.Context, *CryptMetrics) (*MetricsUpdatesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CryptUpdates not implemented")
 }
+func (UnimplementedMetricsExhangeServer) StreamUpdates(MetricsExhange_StreamUpdatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamUpdates not implemented")
+}
+func (UnimplementedMetricsExhangeServer) GetAll(context.Context, *GetAllRequest) (*GetAllResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAll not implemented")
+}
+func (UnimplementedMetricsExhangeServer) GetMany(context.Context, *GetManyRequest) (*MetricsArray, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMany not implemented")
+}
 func (UnimplementedMetricsExhangeServer) mustEmbedUnimplementedMetricsExhangeServer() {}
 
 // UnsafeMetricsExhangeServer may be embedded to opt out of forward compatibility for this service.
@@ -193,6 +260,68 @@ func _MetricsExhange_CryptUpdates_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricsExhange_StreamUpdates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsExhangeServer).StreamUpdates(&metricsExhangeStreamUpdatesServer{stream})
+}
+
+type MetricsExhange_StreamUpdatesServer interface {
+	Send(*StreamAck) error
+	Recv() (*StreamBatch, error)
+	grpc.ServerStream
+}
+
+type metricsExhangeStreamUpdatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsExhangeStreamUpdatesServer) Send(m *StreamAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricsExhangeStreamUpdatesServer) Recv() (*StreamBatch, error) {
+	m := new(StreamBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MetricsExhange_GetAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsExhangeServer).GetAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsExhange_GetAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsExhangeServer).GetAll(ctx, req.(*GetAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsExhange_GetMany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetManyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsExhangeServer).GetMany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsExhange_GetMany_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsExhangeServer).GetMany(ctx, req.(*GetManyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricsExhange_ServiceDesc is the grpc.ServiceDesc for MetricsExhange service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -216,7 +345,22 @@ var MetricsExhange_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CryptUpdates",
 			Handler:    _MetricsExhange_CryptUpdates_Handler,
 		},
+		{
+			MethodName: "GetAll",
+			Handler:    _MetricsExhange_GetAll_Handler,
+		},
+		{
+			MethodName: "GetMany",
+			Handler:    _MetricsExhange_GetMany_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamUpdates",
+			Handler:       _MetricsExhange_StreamUpdates_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
-	Metadata: "internal/rpc/rpc.proto",
+	Metadata: "rpc.proto",
 }
@@ -0,0 +1,11 @@
+package proto
+
+import "google.golang.org/protobuf/proto"
+
+// SignedMessage returns signed part of the batch: encrypted metrics if they are set, otherwise plain metrics.
+func (x *StreamBatch) SignedMessage() proto.Message {
+	if x.GetCrypt() != nil {
+		return x.Crypt
+	}
+	return x.GetMetrics()
+}
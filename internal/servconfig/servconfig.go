@@ -8,36 +8,58 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/impr0ver/metrics-service/internal/crypt"
 )
 
 type Config struct {
-	ListenAddr        string          `json:"address"`
-	StoreInterval     time.Duration   `json:"store_interval"`
-	StoreFile         string          `json:"store_file"`
-	Restore           bool            `json:"restore" default:"true"`
-	DatabaseDSN       string          `json:"database_dsn"`
-	DefaultCtxTimeout time.Duration   `json:"-"`
-	Key               string          `json:"-"`
-	PathToPrivKey     string          `json:"crypto_key"`
-	PrivateKey        *rsa.PrivateKey `json:"-"`
-	TrustedSubnet     string          `json:"trusted_subnet"`
+	ListenAddr          string          `json:"address"`
+	StoreInterval       time.Duration   `json:"store_interval"`
+	StoreFile           string          `json:"store_file"`
+	Restore             bool            `json:"restore" default:"true"`
+	DatabaseDSN         string          `json:"database_dsn"`
+	DefaultCtxTimeout   time.Duration   `json:"-"`
+	Key                 string          `json:"-"`
+	PathToPrivKey       string          `json:"crypto_key"`
+	PrivateKey          *rsa.PrivateKey `json:"-"`
+	TrustedSubnet       string          `json:"trusted_subnet"`
+	IdempotencyWindow   time.Duration   `json:"idempotency_window"`
+	StatsdAddr          string          `json:"statsd_address"`
+	StatsdSocket        string          `json:"statsd_socket"`
+	StatsdFlushInterval time.Duration   `json:"statsd_flush_interval"`
+	GraphiteAddr        string          `json:"graphite_address"`
+	GraphiteTemplates   []string        `json:"graphite_templates"`
+	GRPCAddr            string          `json:"grpc_address"`
+	GRPCTLSCert         string          `json:"grpc_tls_cert"`
+	GRPCTLSKey          string          `json:"grpc_tls_key"`
+	GRPCClientCA        string          `json:"grpc_client_ca"`
+	RejectLegacySign    bool            `json:"reject_legacy_signature"`
 }
 
 var (
-	defaultListenAddr    = "localhost:8080"
-	defaultStoreInterval = 300 * time.Second
-	defaultStoreFile     = "/tmp/metrics-db.json"
-	defaultRestoreValue  = true
-	defaultDSN           = "" //user=postgres password=karat911 host=localhost port=5432 dbname=metrics sslmode=disable
-	DefaultCtxTimeout    = 20 * time.Second
-	defaultKey           = ""
-	defaultPathToPrivKey = ""
-	defaultPathToConfig  = ""
-	pathToConfig         = defaultPathToConfig
-	defaultTrustedSubnet = "192.168.0.0/16"
+	defaultListenAddr          = "localhost:8080"
+	defaultStoreInterval       = 300 * time.Second
+	defaultStoreFile           = "/tmp/metrics-db.json"
+	defaultRestoreValue        = true
+	defaultDSN                 = "" //user=postgres password=karat911 host=localhost port=5432 dbname=metrics sslmode=disable
+	DefaultCtxTimeout          = 20 * time.Second
+	defaultKey                 = ""
+	defaultPathToPrivKey       = ""
+	defaultPathToConfig        = ""
+	pathToConfig               = defaultPathToConfig
+	defaultTrustedSubnet       = "192.168.0.0/16"
+	defaultIdempotencyWindow   = 5 * time.Minute
+	defaultStatsdAddr          = ""
+	defaultStatsdSocket        = ""
+	defaultStatsdFlushInterval = 10 * time.Second
+	defaultGraphiteAddr        = ""
+	defaultGRPCAddr            = "localhost:9090"
+	defaultGRPCTLSCert         = ""
+	defaultGRPCTLSKey          = ""
+	defaultGRPCClientCA        = ""
+	defaultRejectLegacySign    = false
 )
 
 func (c *Config) UnmarshalJSON(data []byte) error {
@@ -45,7 +67,9 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 
 	customConfig := &struct {
 		*configAlias
-		StoreInterval string `json:"store_interval"`
+		StoreInterval       string `json:"store_interval"`
+		IdempotencyWindow   string `json:"idempotency_window"`
+		StatsdFlushInterval string `json:"statsd_flush_interval"`
 	}{
 		configAlias: (*configAlias)(c),
 	}
@@ -59,6 +83,22 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	}
 	c.StoreInterval = duration
 
+	if customConfig.IdempotencyWindow != "" {
+		duration, err = time.ParseDuration(customConfig.IdempotencyWindow)
+		if err != nil {
+			return err
+		}
+		c.IdempotencyWindow = duration
+	}
+
+	if customConfig.StatsdFlushInterval != "" {
+		duration, err = time.ParseDuration(customConfig.StatsdFlushInterval)
+		if err != nil {
+			return err
+		}
+		c.StatsdFlushInterval = duration
+	}
+
 	return nil
 }
 
@@ -90,6 +130,37 @@ func ParseParameters() Config {
 		if tmpcfg.TrustedSubnet != "" {
 			defaultTrustedSubnet = tmpcfg.TrustedSubnet
 		}
+		if tmpcfg.IdempotencyWindow != 0 {
+			defaultIdempotencyWindow = tmpcfg.IdempotencyWindow
+		}
+		if tmpcfg.StatsdAddr != "" {
+			defaultStatsdAddr = tmpcfg.StatsdAddr
+		}
+		if tmpcfg.StatsdSocket != "" {
+			defaultStatsdSocket = tmpcfg.StatsdSocket
+		}
+		if tmpcfg.StatsdFlushInterval != 0 {
+			defaultStatsdFlushInterval = tmpcfg.StatsdFlushInterval
+		}
+		if tmpcfg.GraphiteAddr != "" {
+			defaultGraphiteAddr = tmpcfg.GraphiteAddr
+		}
+		cfg.GraphiteTemplates = tmpcfg.GraphiteTemplates
+		if tmpcfg.GRPCAddr != "" {
+			defaultGRPCAddr = tmpcfg.GRPCAddr
+		}
+		if tmpcfg.GRPCTLSCert != "" {
+			defaultGRPCTLSCert = tmpcfg.GRPCTLSCert
+		}
+		if tmpcfg.GRPCTLSKey != "" {
+			defaultGRPCTLSKey = tmpcfg.GRPCTLSKey
+		}
+		if tmpcfg.GRPCClientCA != "" {
+			defaultGRPCClientCA = tmpcfg.GRPCClientCA
+		}
+		if tmpcfg.RejectLegacySign {
+			defaultRejectLegacySign = true
+		}
 	} else {
 		if err.Error() != "no config file" {
 			log.Printf("read config error, %v", err)
@@ -106,6 +177,16 @@ func ParseParameters() Config {
 	flag.StringVar(&cfg.Key, "k", defaultKey, "Secret key")
 	flag.StringVar(&cfg.PathToPrivKey, "crypto-key", defaultPathToPrivKey, "Private key for asymmetric encoding")
 	flag.StringVar(&cfg.TrustedSubnet, "t", defaultTrustedSubnet, "trusted subnet in CIDR format")
+	flag.DurationVar(&cfg.IdempotencyWindow, "idempotency-window", defaultIdempotencyWindow, "How long idempotency keys are remembered, 0 disables")
+	flag.StringVar(&cfg.StatsdAddr, "statsd", defaultStatsdAddr, "StatsD UDP address and port, empty disables")
+	flag.StringVar(&cfg.StatsdSocket, "statsd-socket", defaultStatsdSocket, "StatsD unixgram socket path, empty disables")
+	flag.DurationVar(&cfg.StatsdFlushInterval, "statsd-flush", defaultStatsdFlushInterval, "StatsD flush interval")
+	flag.StringVar(&cfg.GraphiteAddr, "graphite", defaultGraphiteAddr, "Graphite plaintext TCP address and port, empty disables")
+	flag.StringVar(&cfg.GRPCAddr, "grpc", defaultGRPCAddr, "gRPC server address and port, empty disables")
+	flag.StringVar(&cfg.GRPCTLSCert, "grpc-tls-cert", defaultGRPCTLSCert, "gRPC server TLS certificate, empty serves plaintext")
+	flag.StringVar(&cfg.GRPCTLSKey, "grpc-tls-key", defaultGRPCTLSKey, "gRPC server TLS private key")
+	flag.StringVar(&cfg.GRPCClientCA, "grpc-client-ca", defaultGRPCClientCA, "CA of gRPC client certificates, enables mutual TLS")
+	flag.BoolVar(&cfg.RejectLegacySign, "reject-legacy-signature", defaultRejectLegacySign, "Reject gRPC requests with legacy \"hashsha256\" signature")
 	flag.Parse()
 
 	// third work with env's
@@ -153,6 +234,55 @@ func ParseParameters() Config {
 		cfg.TrustedSubnet = v
 	}
 
+	if v, ok := os.LookupEnv("IDEMPOTENCY_WINDOW"); ok {
+		cfg.IdempotencyWindow, err = time.ParseDuration(v)
+		if err != nil {
+			cfg.IdempotencyWindow = defaultIdempotencyWindow
+		}
+	}
+
+	if v, ok := os.LookupEnv("STATSD_ADDRESS"); ok {
+		cfg.StatsdAddr = v
+	}
+	if v, ok := os.LookupEnv("STATSD_SOCKET"); ok {
+		cfg.StatsdSocket = v
+	}
+	if v, ok := os.LookupEnv("STATSD_FLUSH_INTERVAL"); ok {
+		cfg.StatsdFlushInterval, err = time.ParseDuration(v)
+		if err != nil {
+			cfg.StatsdFlushInterval = defaultStatsdFlushInterval
+		}
+	}
+	if cfg.StatsdFlushInterval <= 0 {
+		cfg.StatsdFlushInterval = defaultStatsdFlushInterval
+	}
+
+	if v, ok := os.LookupEnv("GRAPHITE_ADDRESS"); ok {
+		cfg.GraphiteAddr = v
+	}
+	if v, ok := os.LookupEnv("GRAPHITE_TEMPLATES"); ok { // templates are separated by ";"
+		cfg.GraphiteTemplates = strings.Split(v, ";")
+	}
+
+	if v, ok := os.LookupEnv("GRPC_ADDRESS"); ok {
+		cfg.GRPCAddr = v
+	}
+	if v, ok := os.LookupEnv("GRPC_TLS_CERT"); ok {
+		cfg.GRPCTLSCert = v
+	}
+	if v, ok := os.LookupEnv("GRPC_TLS_KEY"); ok {
+		cfg.GRPCTLSKey = v
+	}
+	if v, ok := os.LookupEnv("GRPC_CLIENT_CA"); ok {
+		cfg.GRPCClientCA = v
+	}
+	if v, ok := os.LookupEnv("REJECT_LEGACY_SIGNATURE"); ok {
+		cfg.RejectLegacySign, err = strconv.ParseBool(v)
+		if err != nil {
+			cfg.RejectLegacySign = defaultRejectLegacySign
+		}
+	}
+
 	return cfg
 }
 
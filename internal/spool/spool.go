@@ -0,0 +1,231 @@
+// Spool package keeps batches of metrics which the agent could not send in a directory on disk,
+// one file per batch, so they are sent later in the same order, also after restart of the agent.
+// The spool is limited by the total size of the files and by the age of batches, the oldest batches are dropped first.
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+)
+
+// batchExt extension of batch files, names are zero-padded sequence numbers.
+const batchExt = ".batch"
+
+type (
+	// Batch metrics of one request. Key is the idempotency key of the request, it is kept on resend,
+	// so the server does not apply the batch twice if the first request was applied.
+	Batch struct {
+		Key     string             `json:"key"`
+		Created time.Time          `json:"created"`
+		Metrics []agmemory.Metrics `json:"metrics"`
+	}
+
+	// Stats numbers of batches: Queued and Dropped since the previous call of TakeStats, Len in the spool now.
+	Stats struct {
+		Queued  int64
+		Dropped int64
+		Len     int
+	}
+
+	// Spool disk-backed queue of batches. Push is safe for concurrent use, Replay must be called by one goroutine.
+	Spool struct {
+		mu       sync.Mutex
+		dir      string
+		maxBytes int64
+		maxAge   time.Duration
+		files    []batchFile // oldest first
+		size     int64
+		next     uint64
+		queued   int64
+		dropped  int64
+	}
+
+	batchFile struct {
+		name    string
+		size    int64
+		created time.Time
+	}
+)
+
+// Open returns spool in dir with batches left by the previous run. Zero maxBytes or maxAge means no limit.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), batchExt+".") { // temporary file of interrupted Push
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		num, ok := strings.CutSuffix(e.Name(), batchExt)
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		seq, err := strconv.ParseUint(num, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		s.files = append(s.files, batchFile{name: e.Name(), size: info.Size(), created: info.ModTime()})
+		s.size += info.Size()
+		if seq >= s.next {
+			s.next = seq + 1
+		}
+	}
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropOld(time.Now())
+	return s, nil
+}
+
+// Push puts the batch at the end of the spool, the oldest batches are dropped if the spool is too big.
+func (s *Spool) Push(b Batch) error {
+	if b.Created.IsZero() {
+		b.Created = time.Now()
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := fmt.Sprintf("%020d%s", s.next, batchExt)
+	s.next++
+	path := filepath.Join(s.dir, name)
+	if err := writeFile(path, data); err != nil {
+		return err
+	}
+	os.Chtimes(path, b.Created, b.Created) // the age of the batch after restart
+
+	s.files = append(s.files, batchFile{name: name, size: int64(len(data)), created: b.Created})
+	s.size += int64(len(data))
+	s.queued++
+	s.dropOld(time.Now())
+	return nil
+}
+
+// Replay sends batches oldest first and removes the sent ones. It stops at the first error of send
+// and returns it, the batch is kept in the spool. Expired and unreadable batches are dropped.
+func (s *Spool) Replay(send func(Batch) error) error {
+	for {
+		s.mu.Lock()
+		s.dropOld(time.Now())
+		if len(s.files) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		f := s.files[0]
+		s.mu.Unlock()
+
+		var b Batch
+		data, err := os.ReadFile(filepath.Join(s.dir, f.name))
+		if err == nil {
+			err = json.Unmarshal(data, &b)
+		}
+		if err != nil {
+			s.remove(f.name, true)
+			continue
+		}
+
+		if err := send(b); err != nil {
+			return err
+		}
+		s.remove(f.name, false)
+	}
+}
+
+// Len returns number of batches in the spool.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// TakeStats returns stats and resets the Queued and Dropped numbers.
+func (s *Spool) TakeStats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Stats{Queued: s.queued, Dropped: s.dropped, Len: len(s.files)}
+	s.queued, s.dropped = 0, 0
+	return st
+}
+
+// remove deletes the batch file if it is still in the spool (Push may have dropped it).
+func (s *Spool) remove(name string, dropped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.files {
+		if f.name != name {
+			continue
+		}
+		s.drop(i)
+		if dropped {
+			s.dropped++
+		}
+		return
+	}
+}
+
+// dropOld drops expired batches and the oldest batches above the size limit, s.mu must be locked.
+func (s *Spool) dropOld(now time.Time) {
+	for len(s.files) > 0 {
+		f := s.files[0]
+		expired := s.maxAge > 0 && now.Sub(f.created) > s.maxAge
+		tooBig := s.maxBytes > 0 && s.size > s.maxBytes
+		if !expired && !tooBig {
+			return
+		}
+		s.drop(0)
+		s.dropped++
+	}
+}
+
+// drop removes i-th batch file, s.mu must be locked.
+func (s *Spool) drop(i int) {
+	os.Remove(filepath.Join(s.dir, s.files[i].name))
+	s.size -= s.files[i].size
+	s.files = append(s.files[:i], s.files[i+1:]...)
+}
+
+// writeFile writes data to the temporary file and renames it, so a batch file is never partially written.
+func writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,86 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/agmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(key string) Batch {
+	delta := int64(1)
+	return Batch{Key: key, Created: time.Now(), Metrics: []agmemory.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}}
+}
+
+func replayKeys(t *testing.T, s *Spool) []string {
+	var keys []string
+	require.NoError(t, s.Replay(func(b Batch) error {
+		keys = append(keys, b.Key)
+		return nil
+	}))
+	return keys
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	require.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Push(batch(key)))
+	}
+	assert.Equal(t, 3, s.Len(), "test #Len")
+
+	// failed send keeps the batch and the order
+	calls := 0
+	err = s.Replay(func(b Batch) error {
+		calls++
+		if b.Key == "b" {
+			return errors.New("server is down")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "server is down", "test #Replay error")
+	assert.Equal(t, 2, calls, "test #Replay stops on error")
+	assert.Equal(t, 2, s.Len(), "test #sent batch is removed")
+
+	// batches are kept after restart
+	require.NoError(t, s.Push(batch("d")))
+	s, err = Open(dir, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, replayKeys(t, s), "test #order after restart")
+	assert.Equal(t, 0, s.Len(), "test #empty after replay")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "test #files are removed")
+}
+
+func TestSpoolLimits(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, time.Hour)
+	require.NoError(t, err)
+	old := batch("old")
+	old.Created = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, s.Push(old))
+	require.NoError(t, s.Push(batch("new")))
+	assert.Equal(t, []string{"new"}, replayKeys(t, s), "test #expired batch is dropped")
+	assert.Equal(t, Stats{Queued: 2, Dropped: 1}, s.TakeStats(), "test #stats")
+	assert.Equal(t, Stats{}, s.TakeStats(), "test #stats are reset")
+
+	dir := t.TempDir()
+	s, err = Open(dir, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Push(batch("a")))
+	size := s.size
+
+	s, err = Open(dir, 2*size, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Push(batch("b")))
+	require.NoError(t, s.Push(batch("c")))
+	assert.Equal(t, []string{"b", "c"}, replayKeys(t, s), "test #oldest batch is dropped above size limit")
+	assert.Equal(t, int64(1), s.TakeStats().Dropped, "test #dropped by size")
+}
@@ -0,0 +1,258 @@
+// Statsd package implements StatsD-compatible receiver of metrics.
+// Lines have the form "name:value|type[|@sample_rate][|#tag:value,...]", supported types are
+// "c" (counter), "g" (gauge, "+N"/"-N" change the current value) and "ms" (timer).
+// Received metrics are aggregated in Aggregator, the server writes them in the storage every flush interval
+// (see statsdstore) and the agent merges them into its memory.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/metricid"
+)
+
+type (
+	// Metric one parsed StatsD line.
+	Metric struct {
+		Name       string // metric ID with tags as labels, see metricid.Format
+		Type       string
+		Value      float64
+		Relative   bool // gauge value is a change of the current value
+		SampleRate float64
+	}
+
+	gaugeValue struct {
+		value    float64
+		relative bool
+	}
+
+	timerValue struct {
+		count float64
+		sum   float64
+		min   float64
+		max   float64
+	}
+
+	// Aggregator accumulates metrics between flushes.
+	Aggregator struct {
+		sync.Mutex
+		counters   map[string]float64
+		gauges     map[string]gaugeValue
+		timers     map[string]*timerValue
+		remainders map[string]float64 // fractional parts of sampled counts carried to the next flush
+	}
+)
+
+const (
+	counterType = "c"
+	gaugeType   = "g"
+	timerType   = "ms"
+	maxPacket   = 65535
+)
+
+// NewAggregator return empty Aggregator.
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]gaugeValue),
+		timers:     make(map[string]*timerValue),
+		remainders: make(map[string]float64),
+	}
+}
+
+// ParseLine parses one StatsD line.
+func ParseLine(line string) (Metric, error) {
+	m := Metric{SampleRate: 1}
+
+	parts := strings.Split(line, "|")
+	colon := strings.LastIndexByte(parts[0], ':')
+	if colon <= 0 || len(parts) < 2 {
+		return m, fmt.Errorf("bad line %q", line)
+	}
+
+	name := parts[0][:colon]
+	value := parts[0][colon+1:]
+	m.Type = parts[1]
+
+	labels := make(map[string]string)
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, fmt.Errorf("bad sample rate %q", p)
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(p, "#"):
+			for _, tag := range strings.Split(p[1:], ",") {
+				k, v, _ := strings.Cut(tag, ":")
+				if k != "" {
+					labels[k] = v
+				}
+			}
+		}
+	}
+	m.Name = metricid.Format(name, labels)
+
+	switch m.Type {
+	case counterType, timerType:
+	case gaugeType:
+		m.Relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	default:
+		return m, fmt.Errorf("unsupported metric type %q", m.Type)
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return m, fmt.Errorf("bad value %q", value)
+	}
+	m.Value = v
+	return m, nil
+}
+
+// Add puts metric into aggregator.
+func (a *Aggregator) Add(m Metric) {
+	a.Lock()
+	defer a.Unlock()
+
+	switch m.Type {
+	case counterType:
+		a.counters[m.Name] += m.Value / m.SampleRate
+	case gaugeType:
+		g, ok := a.gauges[m.Name]
+		if m.Relative && ok {
+			g.value += m.Value
+		} else {
+			g = gaugeValue{value: m.Value, relative: m.Relative}
+		}
+		a.gauges[m.Name] = g
+	case timerType:
+		t, ok := a.timers[m.Name]
+		if !ok {
+			t = &timerValue{min: m.Value, max: m.Value}
+			a.timers[m.Name] = t
+		}
+		// a sample stands for 1/SampleRate values, so count and sum are scaled alike and the mean is not changed
+		t.count += 1 / m.SampleRate
+		t.sum += m.Value / m.SampleRate
+		t.min = math.Min(t.min, m.Value)
+		t.max = math.Max(t.max, m.Value)
+	}
+}
+
+// AddPacket parses lines of the packet and puts them into aggregator, bad lines are returned as error.
+func (a *Aggregator) AddPacket(packet []byte) error {
+	var errs []error
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		a.Add(m)
+	}
+	return errors.Join(errs...)
+}
+
+// Take returns aggregated counters and gauges and resets aggregator. Current returns the stored value of the gauge
+// for relative gauges. Timers are returned as gauges "name.sum", "name.min", "name.max", "name.mean"
+// and counter "name.count", count and sum of sampled timers ("|@rate") are estimates of all values.
+// Sampled counts are rounded, the rest is added to the next count of the counter.
+func (a *Aggregator) Take(current func(id string) (float64, bool)) (map[string]int64, map[string]float64) {
+	a.Lock()
+	counters, gauges, timers := a.counters, a.gauges, a.timers
+	a.counters = make(map[string]float64)
+	a.gauges = make(map[string]gaugeValue)
+	a.timers = make(map[string]*timerValue)
+
+	resCounters := make(map[string]int64, len(counters)+len(timers))
+	for id, v := range counters {
+		resCounters[id] = a.round(id, v)
+	}
+	for id, t := range timers {
+		resCounters[id+".count"] = a.round(id+".count", t.count)
+	}
+	a.Unlock()
+
+	resGauges := make(map[string]float64, len(gauges)+4*len(timers))
+	for id, g := range gauges {
+		if g.relative {
+			if v, ok := current(id); ok {
+				g.value += v
+			}
+		}
+		resGauges[id] = g.value
+	}
+	for id, t := range timers {
+		resGauges[id+".sum"] = t.sum
+		resGauges[id+".min"] = t.min
+		resGauges[id+".max"] = t.max
+		resGauges[id+".mean"] = t.sum / t.count
+	}
+	return resCounters, resGauges
+}
+
+// round returns count of the counter rounded with the rest of the previous counts and keeps the new rest,
+// so fractions of sampled counts are not lost. Aggregator must be locked.
+func (a *Aggregator) round(id string, v float64) int64 {
+	v += a.remainders[id]
+	n := math.Round(v)
+	if rest := v - n; rest != 0 {
+		a.remainders[id] = rest
+	} else {
+		delete(a.remainders, id)
+	}
+	return int64(n)
+}
+
+// ListenAndServe listens on network ("udp" or "unixgram") address and serves packets until ctx is done.
+func ListenAndServe(ctx context.Context, network, address string, a *Aggregator) error {
+	if network == "unixgram" {
+		os.Remove(address) // stale socket of the previous run
+		defer os.Remove(address)
+	}
+
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return fmt.Errorf("statsd listen %s %s: %w", network, address, err)
+	}
+	return Serve(ctx, conn, a)
+}
+
+// Serve reads packets from conn until ctx is done. Conn is closed on return.
+func Serve(ctx context.Context, conn net.PacketConn, a *Aggregator) error {
+	var sLogger = logger.NewLogger()
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxPacket)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := a.AddPacket(buf[:n]); err != nil {
+			sLogger.Infof("statsd: %v", err)
+		}
+	}
+}
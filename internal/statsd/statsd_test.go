@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Metric
+	}{
+		{"counter #1", "requests:1|c", Metric{Name: "requests", Type: "c", Value: 1, SampleRate: 1}},
+		{"counter with rate #2", "requests:2|c|@0.5", Metric{Name: "requests", Type: "c", Value: 2, SampleRate: 0.5}},
+		{"gauge #3", "queue:15|g", Metric{Name: "queue", Type: "g", Value: 15, SampleRate: 1}},
+		{"relative gauge #4", "queue:-3|g", Metric{Name: "queue", Type: "g", Value: -3, Relative: true, SampleRate: 1}},
+		{"timer with tags #5", "latency:320|ms|#host:srv1,route:/api", Metric{Name: `latency{host="srv1",route="/api"}`, Type: "ms", Value: 320, SampleRate: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m)
+		})
+	}
+
+	for _, line := range []string{"requests", "requests:1", "requests:x|c", "requests:1|s", "requests:1|c|@2"} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestAggregatorSampledTimer(t *testing.T) {
+	a := NewAggregator()
+	require.NoError(t, a.AddPacket([]byte("latency:100|ms|@0.5\nlatency:300|ms|@0.5\nlatency:200|ms")))
+
+	counters, gauges := a.Take(func(string) (float64, bool) { return 0, false })
+	assert.Equal(t, int64(5), counters["latency.count"], "test #count with sample rate")
+	assert.Equal(t, float64(1000), gauges["latency.sum"], "test #sum with sample rate")
+	assert.Equal(t, float64(200), gauges["latency.mean"], "test #mean is not changed by sample rate")
+	assert.Equal(t, float64(100), gauges["latency.min"])
+}
+
+func TestAggregatorSampledCounterRest(t *testing.T) {
+	a := NewAggregator()
+	none := func(string) (float64, bool) { return 0, false }
+
+	var total int64
+	for i := 0; i < 3; i++ {
+		require.NoError(t, a.AddPacket([]byte("hits:1|c|@0.3\nlatency:100|ms|@0.3")))
+		counters, _ := a.Take(none)
+		total += counters["hits"]
+		assert.Equal(t, counters["hits"], counters["latency.count"], "test #%d timer count", i+1)
+	}
+	assert.Equal(t, int64(10), total, "test #rest of sampled counter is carried to the next flush")
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	a := NewAggregator()
+	done := make(chan error)
+	go func() {
+		done <- Serve(ctx, conn, a)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("requests:3|c"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		a.Lock()
+		defer a.Unlock()
+		return a.counters["requests"] == 3
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	counters, _ := a.Take(func(string) (float64, bool) { return 0, false })
+	assert.Equal(t, map[string]int64{"requests": 3}, counters)
+}
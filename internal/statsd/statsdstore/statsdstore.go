@@ -0,0 +1,55 @@
+// Statsdstore package writes metrics aggregated by statsd.Aggregator in the server storage.
+// It is separate from statsd, so the agent, which also receives StatsD, does not link the server storage.
+package statsdstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/logger"
+	"github.com/impr0ver/metrics-service/internal/servconfig"
+	"github.com/impr0ver/metrics-service/internal/statsd"
+	"github.com/impr0ver/metrics-service/internal/storage"
+)
+
+// Flush writes aggregated metrics in the storage and resets aggregator, see statsd.Aggregator.Take.
+func Flush(ctx context.Context, a *statsd.Aggregator, ms storage.MemoryStoragerInterface) error {
+	counters, gauges := a.Take(func(id string) (float64, bool) {
+		current, err := ms.GetGaugeByKey(ctx, id)
+		return float64(current), err == nil
+	})
+	if len(counters)+len(gauges) == 0 {
+		return nil
+	}
+
+	metrics := make([]storage.Metrics, 0, len(counters)+len(gauges))
+	for id, delta := range counters {
+		delta := delta
+		metrics = append(metrics, storage.Metrics{ID: id, MType: "counter", Delta: &delta})
+	}
+	for id, value := range gauges {
+		value := value
+		metrics = append(metrics, storage.Metrics{ID: id, MType: "gauge", Value: &value})
+	}
+	return ms.AddNewMetricsAsBatch(ctx, metrics)
+}
+
+// Run flushes aggregator every interval until ctx is done, then flushes the rest.
+func Run(ctx context.Context, a *statsd.Aggregator, ms storage.MemoryStoragerInterface, interval time.Duration) error {
+	var sLogger = logger.NewLogger()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := Flush(ctx, a, ms); err != nil {
+				sLogger.Errorf("statsd flush error: %v", err)
+			}
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), servconfig.DefaultCtxTimeout)
+			defer cancel()
+			return Flush(flushCtx, a, ms)
+		}
+	}
+}
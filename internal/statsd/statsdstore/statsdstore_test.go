@@ -0,0 +1,57 @@
+package statsdstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/impr0ver/metrics-service/internal/statsd"
+	"github.com/impr0ver/metrics-service/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlush(t *testing.T) {
+	ctx := context.Background()
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+	ms.UpdateGauge(ctx, "queue", 10)
+
+	a := statsd.NewAggregator()
+	err := a.AddPacket([]byte("requests:1|c\nrequests:1|c|@0.1\nqueue:+5|g\nqueue:-2|g\nlevel:7|g\nlatency:100|ms\nlatency:300|ms\nbad line"))
+	assert.Error(t, err, "test #bad line")
+
+	require.NoError(t, Flush(ctx, a, ms))
+
+	counter, _ := ms.GetCounterByKey(ctx, "requests")
+	assert.Equal(t, storage.Counter(11), counter, "test #counter with sample rate")
+	gauge, _ := ms.GetGaugeByKey(ctx, "queue")
+	assert.Equal(t, storage.Gauge(13), gauge, "test #relative gauge")
+	gauge, _ = ms.GetGaugeByKey(ctx, "level")
+	assert.Equal(t, storage.Gauge(7), gauge, "test #gauge")
+	counter, _ = ms.GetCounterByKey(ctx, "latency.count")
+	assert.Equal(t, storage.Counter(2), counter, "test #timer count")
+	gauge, _ = ms.GetGaugeByKey(ctx, "latency.mean")
+	assert.Equal(t, storage.Gauge(200), gauge, "test #timer mean")
+	gauge, _ = ms.GetGaugeByKey(ctx, "latency.max")
+	assert.Equal(t, storage.Gauge(300), gauge, "test #timer max")
+
+	// aggregator is empty after flush
+	require.NoError(t, Flush(ctx, a, ms))
+	counter, _ = ms.GetCounterByKey(ctx, "requests")
+	assert.Equal(t, storage.Counter(11), counter, "test #second flush")
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ms := &storage.MemoryStorage{Gauges: make(map[string]storage.Gauge), Counters: make(map[string]storage.Counter)}
+
+	a := statsd.NewAggregator()
+	require.NoError(t, a.AddPacket([]byte("requests:3|c")))
+
+	// the rest is flushed on return
+	cancel()
+	require.NoError(t, Run(ctx, a, ms, time.Hour))
+	counter, _ := ms.GetCounterByKey(context.Background(), "requests")
+	assert.Equal(t, storage.Counter(3), counter)
+}
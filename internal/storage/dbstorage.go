@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/impr0ver/metrics-service/internal/idempotency"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -46,11 +48,14 @@ func checkDSN(dsn string) (err error) {
 	return err
 }
 
-//createTables creates two tables in db% Counter and Gauge
+// createTables creates tables in db% Counter, Gauge and Idempotency.
+// IDs with labels (name{k="v",...}) have no length limit, so ids and keys are text,
+// see migrateTextIDs for tables made with varchar(255) ids.
 func createTables(ctx context.Context, d *DBStorage) (err error) {
 	const (
-		tableCounter = `CREATE TABLE IF NOT EXISTS Counter (id varchar(255) PRIMARY KEY, delta bigint);`
-		tableGauge   = `CREATE TABLE IF NOT EXISTS Gauge (id varchar(255) PRIMARY KEY, value double precision);`
+		tableCounter     = `CREATE TABLE IF NOT EXISTS Counter (id text PRIMARY KEY, delta bigint);`
+		tableGauge       = `CREATE TABLE IF NOT EXISTS Gauge (id text PRIMARY KEY, value double precision);`
+		tableIdempotency = `CREATE TABLE IF NOT EXISTS Idempotency (key text PRIMARY KEY, status integer, content_type varchar(255), body bytea, expires timestamptz);`
 	)
 
 	if _, err = d.DB.ExecContext(ctx, tableCounter); err != nil {
@@ -59,6 +64,40 @@ func createTables(ctx context.Context, d *DBStorage) (err error) {
 	if _, err = d.DB.ExecContext(ctx, tableGauge); err != nil {
 		return fmt.Errorf("error create table \"Gauge\": %w", err)
 	}
+	if _, err = d.DB.ExecContext(ctx, tableIdempotency); err != nil {
+		return fmt.Errorf("error create table \"Idempotency\": %w", err)
+	}
+	return migrateTextIDs(ctx, d)
+}
+
+// migrateTextIDs converts varchar ids and keys of tables made by older versions to text.
+// Columns are checked first, so ALTER TABLE (it locks and may rewrite the table) runs only once.
+func migrateTextIDs(ctx context.Context, d *DBStorage) error {
+	rows, err := d.DB.QueryContext(ctx, `SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND data_type <> 'text' AND
+		((table_name IN ('counter', 'gauge') AND column_name = 'id') OR (table_name = 'idempotency' AND column_name = 'key'));`)
+	if err != nil {
+		return fmt.Errorf("error check id columns: %w", err)
+	}
+	defer rows.Close()
+
+	var alters []string
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return err
+		}
+		alters = append(alters, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE text;`, table, column))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, alter := range alters {
+		if _, err := d.DB.ExecContext(ctx, alter); err != nil {
+			return fmt.Errorf("error alter table: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -167,7 +206,7 @@ func (d *DBStorage) DBPing(ctx context.Context) error {
 	return err
 }
 
-// AddNewMetricsAsBatch add or update metrics (storage in db). 
+// AddNewMetricsAsBatch add or update metrics (storage in db).
 func (d *DBStorage) AddNewMetricsAsBatch(ctx context.Context, metrics []Metrics) error {
 	tx, err := d.DB.Begin()
 	if err != nil {
@@ -203,3 +242,43 @@ func (d *DBStorage) AddNewMetricsAsBatch(ctx context.Context, metrics []Metrics)
 	}
 	return tx.Commit()
 }
+
+// Begin reserves idempotency key (storage in db). Expired keys are removed on each call.
+func (d *DBStorage) Begin(ctx context.Context, key string, window time.Duration) (*idempotency.Response, error) {
+	now := time.Now()
+	if _, err := d.DB.ExecContext(ctx, `DELETE FROM Idempotency WHERE expires < $1;`, now); err != nil {
+		return nil, err
+	}
+
+	res, err := d.DB.ExecContext(ctx, `INSERT INTO Idempotency (key, status, expires) VALUES ($1, 0, $2) ON CONFLICT (key) DO NOTHING;`, key, now.Add(window))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 1 {
+		return nil, nil
+	}
+
+	var resp idempotency.Response
+	row := d.DB.QueryRowContext(ctx, `SELECT status, content_type, body FROM Idempotency WHERE key = $1;`, key)
+	var contentType sql.NullString
+	if err := row.Scan(&resp.Status, &contentType, &resp.Body); err != nil {
+		return nil, err
+	}
+	if resp.Status == 0 {
+		return nil, idempotency.ErrInProgress
+	}
+	resp.ContentType = contentType.String
+	return &resp, nil
+}
+
+// Complete saves response for idempotency key (storage in db).
+func (d *DBStorage) Complete(ctx context.Context, key string, resp idempotency.Response) error {
+	_, err := d.DB.ExecContext(ctx, `UPDATE Idempotency SET status = $1, content_type = $2, body = $3 WHERE key = $4;`, resp.Status, resp.ContentType, resp.Body, key)
+	return err
+}
+
+// Release removes idempotency key (storage in db).
+func (d *DBStorage) Release(ctx context.Context, key string) error {
+	_, err := d.DB.ExecContext(ctx, `DELETE FROM Idempotency WHERE key = $1;`, key)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/impr0ver/metrics-service/internal/idempotency"
 	"github.com/impr0ver/metrics-service/internal/storage"
 	"github.com/stretchr/testify/suite"
 )
@@ -186,8 +187,31 @@ func (suite *DBStorageTestSuite) TestAddNewMetricsAsBatch() {
 
 }
 
+func (suite *DBStorageTestSuite) TestDBStorageIdempotency() {
+	ctx := context.Background()
+
+	saved, err := suite.DB.Begin(ctx, "key1", time.Minute)
+	suite.NoError(err)
+	suite.Nil(saved)
+
+	_, err = suite.DB.Begin(ctx, "key1", time.Minute)
+	suite.ErrorIs(err, idempotency.ErrInProgress)
+
+	resp := idempotency.Response{Status: 200, ContentType: "text/plain", Body: []byte("Registered successfully!")}
+	suite.NoError(suite.DB.Complete(ctx, "key1", resp))
+
+	saved, err = suite.DB.Begin(ctx, "key1", time.Minute)
+	suite.NoError(err)
+	suite.Equal(&resp, saved)
+
+	suite.NoError(suite.DB.Release(ctx, "key1"))
+	saved, err = suite.DB.Begin(ctx, "key1", time.Minute)
+	suite.NoError(err)
+	suite.Nil(saved)
+}
+
 func (suite *DBStorageTestSuite) SetupTest() {
-	suite.DB.DB.Exec("TRUNCATE Gauge, Counter CASCADE;")
+	suite.DB.DB.Exec("TRUNCATE Gauge, Counter, Idempotency CASCADE;")
 }
 
 func TestDBStorageTestSuite(t *testing.T) {